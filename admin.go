@@ -0,0 +1,313 @@
+package mockaroo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//adminPathPrefix is reserved for the admin API, mocks cannot be declared under it
+	adminPathPrefix = "/__mockaroo"
+	adminMocksPath  = adminPathPrefix + "/mocks"
+	adminMockPath   = adminMocksPath + "/{name}"
+
+	adminRequestsPath     = adminPathPrefix + "/requests"
+	adminRequestCountPath = adminRequestsPath + "/count"
+
+	adminScenariosPath     = adminPathPrefix + "/scenarios"
+	adminScenarioPath      = adminScenariosPath + "/{name}"
+	adminScenarioResetPath = adminScenariosPath + "/reset"
+
+	adminSequenceResetPath = adminPathPrefix + "/sequences/reset"
+
+	// pseudo file name used in errors for mocks sent to the admin API
+	adminConfigName = "<admin>"
+)
+
+//adminError is an admin API failure that maps to a specific HTTP status
+type adminError struct {
+	status  int
+	message string
+}
+
+func (e *adminError) Error() string {
+	return e.message
+}
+
+func isAdminPath(path string) bool {
+	return path == adminPathPrefix || strings.HasPrefix(path, adminPathPrefix+"/")
+}
+
+func (s *muxServer) getAdminRouter() *mux.Router {
+	s.adminOnce.Do(func() {
+		s.adminRouter = s.newAdminRouter()
+	})
+	return s.adminRouter
+}
+
+//newAdminRouter builds the router for the admin REST API
+func (s *muxServer) newAdminRouter() *mux.Router {
+	router := mux.NewRouter()
+
+	router.HandleFunc(adminMocksPath, s.listMocks).Methods(http.MethodGet)
+	router.HandleFunc(adminMocksPath, s.addMock).Methods(http.MethodPost)
+	router.HandleFunc(adminMockPath, s.getMock).Methods(http.MethodGet)
+	router.HandleFunc(adminMockPath, s.replaceMock).Methods(http.MethodPut)
+	router.HandleFunc(adminMockPath, s.deleteMock).Methods(http.MethodDelete)
+
+	router.HandleFunc(adminRequestsPath, s.listRequests).Methods(http.MethodGet)
+	router.HandleFunc(adminRequestsPath, s.resetRequests).Methods(http.MethodDelete)
+	router.HandleFunc(adminRequestCountPath, s.countRequests).Methods(http.MethodGet)
+
+	router.HandleFunc(adminScenariosPath, s.listScenarios).Methods(http.MethodGet)
+	router.HandleFunc(adminScenarioResetPath, s.resetScenarios).Methods(http.MethodPost)
+	router.HandleFunc(adminScenarioPath, s.setScenario).Methods(http.MethodPut)
+
+	router.HandleFunc(adminSequenceResetPath, s.resetSequences).Methods(http.MethodPost)
+
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeAdminError(w, &adminError{status: http.StatusNotFound, message: "unknown admin endpoint"})
+	})
+
+	return router
+}
+
+func (s *muxServer) listMocks(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, s.getConf().ServerConfig.Mocks)
+}
+
+func (s *muxServer) getMock(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	mocks := s.getConf().ServerConfig.Mocks
+
+	i := mockIndex(mocks, name)
+	if i < 0 {
+		writeAdminError(w, mockNotFoundErr(name))
+		return
+	}
+	writeJSON(w, http.StatusOK, mocks[i])
+}
+
+func (s *muxServer) addMock(w http.ResponseWriter, req *http.Request) {
+	mock, err := decodeMock(req, "")
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	err = s.updateMocks(func(mocks []*Mock) ([]*Mock, error) {
+		if mockIndex(mocks, mock.Name) >= 0 {
+			errMsg := fmt.Sprintf("mock with name %v already exists", mock.Name)
+			return nil, &adminError{status: http.StatusConflict, message: errMsg}
+		}
+		return append(mocks, mock), nil
+	})
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	log.Infof("admin added mock:\"%v\"", mock.Name)
+	writeJSON(w, http.StatusCreated, mock)
+}
+
+func (s *muxServer) replaceMock(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	mock, err := decodeMock(req, name)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	err = s.updateMocks(func(mocks []*Mock) ([]*Mock, error) {
+		i := mockIndex(mocks, name)
+		if i < 0 {
+			return nil, mockNotFoundErr(name)
+		}
+		// keep the position so the matching order does not change
+		mocks[i] = mock
+		return mocks, nil
+	})
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	s.sequences.reset(name)
+	log.Infof("admin replaced mock:\"%v\"", name)
+	writeJSON(w, http.StatusOK, mock)
+}
+
+func (s *muxServer) deleteMock(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+
+	err := s.updateMocks(func(mocks []*Mock) ([]*Mock, error) {
+		i := mockIndex(mocks, name)
+		if i < 0 {
+			return nil, mockNotFoundErr(name)
+		}
+		return append(mocks[:i], mocks[i+1:]...), nil
+	})
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	s.sequences.reset(name)
+	log.Infof("admin deleted mock:\"%v\"", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *muxServer) listRequests(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, s.Requests(requestFilterFromQuery(req)))
+}
+
+func (s *muxServer) countRequests(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count": len(s.Requests(requestFilterFromQuery(req))),
+	})
+}
+
+func (s *muxServer) resetRequests(w http.ResponseWriter, req *http.Request) {
+	s.ResetRequests()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *muxServer) listScenarios(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, s.ScenarioStates())
+}
+
+func (s *muxServer) resetScenarios(w http.ResponseWriter, req *http.Request) {
+	s.ResetScenarios()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//setScenario moves a scenario to the state in the JSON body {"state": "..."}
+func (s *muxServer) setScenario(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || strings.TrimSpace(body.State) == "" {
+		writeAdminError(w, &adminError{status: http.StatusBadRequest, message: "expected JSON body with non empty \"state\""})
+		return
+	}
+
+	s.scenarios.set(name, body.State)
+	log.Infof("admin moved scenario:\"%v\" to \"%v\"", name, body.State)
+	writeJSON(w, http.StatusOK, map[string]string{name: body.State})
+}
+
+//resetSequences starts response sequences over, only for the mock
+//in the mock query param if present
+func (s *muxServer) resetSequences(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("mock")
+	if name != "" && mockIndex(s.getConf().ServerConfig.Mocks, name) < 0 {
+		writeAdminError(w, mockNotFoundErr(name))
+		return
+	}
+	s.ResetSequences(name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//requestFilterFromQuery builds a journal filter from the query params
+//mock, method, path, body_contains and unmatched
+func requestFilterFromQuery(req *http.Request) RequestFilter {
+	q := req.URL.Query()
+	return RequestFilter{
+		MockName:     q.Get("mock"),
+		Method:       q.Get("method"),
+		Path:         q.Get("path"),
+		BodyContains: q.Get("body_contains"),
+		Unmatched:    q.Get("unmatched") == "true",
+	}
+}
+
+//updateMocks applies change to a copy of the current mocks and swaps in a router
+//built from the result, requests in flight keep using the old router; changes
+//are serialized so that concurrent admin calls do not lose updates
+func (s *muxServer) updateMocks(change func([]*Mock) ([]*Mock, error)) error {
+	s.adminMu.Lock()
+	defer s.adminMu.Unlock()
+
+	conf := s.getConf()
+	mocks, err := change(append([]*Mock{}, conf.ServerConfig.Mocks...))
+	if err != nil {
+		return err
+	}
+
+	warnShadowedMocks(mocks, mockListeners(conf.ServerConfig.listeners, mocks))
+
+	sc := *conf.ServerConfig
+	sc.Mocks = mocks
+	newConf := *conf
+	newConf.ServerConfig = &sc
+
+	return s.Reload(&newConf)
+}
+
+//decodeMock reads a JSON mock from the request body and runs the same validation
+//as mocks in config files, name if not empty is the name from the URL
+func decodeMock(req *http.Request, name string) (*Mock, error) {
+	var mock Mock
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&mock); err != nil {
+		errMsg := fmt.Sprintf("invalid mock JSON: %v", err)
+		return nil, &adminError{status: http.StatusBadRequest, message: errMsg}
+	}
+
+	if name != "" {
+		if mock.Name != "" && mock.Name != name {
+			errMsg := fmt.Sprintf("mock name \"%v\" does not match \"%v\" in path", mock.Name, name)
+			return nil, &adminError{status: http.StatusBadRequest, message: errMsg}
+		}
+		mock.Name = name
+	}
+
+	if strings.TrimSpace(mock.Name) == "" {
+		return nil, &adminError{status: http.StatusBadRequest, message: "invalid empty name for mock, please provide a valid name"}
+	}
+
+	if err := validateMock(adminConfigName, &mock); err != nil {
+		return nil, &adminError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	return &mock, nil
+}
+
+func mockIndex(mocks []*Mock, name string) int {
+	for i, m := range mocks {
+		if m.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func mockNotFoundErr(name string) error {
+	return &adminError{status: http.StatusNotFound, message: fmt.Sprintf("no mock with name %v", name)}
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if ae, ok := err.(*adminError); ok {
+		status = ae.status
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"message": err.Error(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("error writing JSON response: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package mockaroo
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+const adminTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+	mock "hello_world" {
+		request {
+			path = "/hello"
+			verb = "GET"
+		}
+		response {
+			body = "world"
+		}
+	}
+}
+`
+
+func TestAdminMockLifecycle(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(adminTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	newMock := `{
+		"name": "goodbye",
+		"request": {"path": "/goodbye/{name}", "verb": "GET"},
+		"response": {"status": 202, "body": "bye {{.PathVariable \"name\"}}"}
+	}`
+
+	if code := adminCall(t, http.MethodPost, ts.URL+adminMocksPath, newMock); code != http.StatusCreated {
+		t.Fatalf("expected add mock to return 201 found:%v", code)
+	}
+
+	if body := getBody(t, ts.URL+"/goodbye/bob"); body != "bye bob" {
+		t.Errorf("expected added mock to respond with:bye bob found:%v", body)
+	}
+
+	// adding a mock with the same name again is a conflict
+	if code := adminCall(t, http.MethodPost, ts.URL+adminMocksPath, newMock); code != http.StatusConflict {
+		t.Errorf("expected duplicate add to return 409 found:%v", code)
+	}
+
+	resp, err := http.Get(ts.URL + adminMocksPath)
+	if err != nil {
+		t.Fatalf("list mocks failed with error:%v", err)
+	}
+	var mocks []*Mock
+	json.NewDecoder(resp.Body).Decode(&mocks)
+	resp.Body.Close()
+	if len(mocks) != 2 || mocks[0].Name != "hello_world" || mocks[1].Name != "goodbye" {
+		t.Errorf("expected mocks hello_world and goodbye found:%v", mocks)
+	}
+
+	replaced := `{
+		"request": {"path": "/goodbye/{name}", "verb": "GET"},
+		"response": {"body": "see you {{.PathVariable \"name\"}}"}
+	}`
+	if code := adminCall(t, http.MethodPut, ts.URL+adminMocksPath+"/goodbye", replaced); code != http.StatusOK {
+		t.Fatalf("expected replace mock to return 200 found:%v", code)
+	}
+
+	if body := getBody(t, ts.URL+"/goodbye/bob"); body != "see you bob" {
+		t.Errorf("expected replaced mock to respond with:see you bob found:%v", body)
+	}
+
+	if code := adminCall(t, http.MethodDelete, ts.URL+adminMocksPath+"/goodbye", ""); code != http.StatusNoContent {
+		t.Fatalf("expected delete mock to return 204 found:%v", code)
+	}
+
+	resp, err = http.Get(ts.URL + "/goodbye/bob")
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected deleted mock to 404 found:%v", resp.StatusCode)
+	}
+
+	if code := adminCall(t, http.MethodDelete, ts.URL+adminMocksPath+"/goodbye", ""); code != http.StatusNotFound {
+		t.Errorf("expected delete of missing mock to return 404 found:%v", code)
+	}
+}
+
+func TestAdminRejectsInvalidMocks(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(adminTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	invalid := []string{
+		`{"name": "bad_verb", "request": {"path": "/x", "verb": "FETCH"}, "response": {"body": "x"}}`,
+		`{"name": "bad_path", "request": {"path": "x", "verb": "GET"}, "response": {"body": "x"}}`,
+		`{"name": "reserved", "request": {"path": "/__mockaroo/mocks", "verb": "GET"}, "response": {"body": "x"}}`,
+		`{"name": "no_body", "request": {"path": "/x", "verb": "GET"}, "response": {}}`,
+		`{"name": "typo", "request": {"path": "/x", "verb": "GET"}, "response": {"bodee": "x"}}`,
+		`{"request": {"path": "/x", "verb": "GET"}, "response": {"body": "x"}}`,
+		`not json`,
+	}
+
+	for _, m := range invalid {
+		if code := adminCall(t, http.MethodPost, ts.URL+adminMocksPath, m); code != http.StatusBadRequest {
+			t.Errorf("expected invalid mock to return 400 found:%v for %s", code, m)
+		}
+	}
+}
+
+func TestAdminChangesUnderConcurrentTraffic(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(adminTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if body := getBody(t, ts.URL+"/hello"); body != "world" {
+					t.Errorf("expected response body:world during admin changes found:%v", body)
+				}
+			}
+		}()
+	}
+
+	names := []string{"a", "b", "c", "d", "e"}
+	for _, n := range names {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			m := `{"name": "` + n + `", "request": {"path": "/` + n + `", "verb": "GET"}, "response": {"body": "` + n + `"}}`
+			if code := adminCall(t, http.MethodPost, ts.URL+adminMocksPath, m); code != http.StatusCreated {
+				t.Errorf("expected add mock to return 201 found:%v", code)
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	// no update should be lost
+	for _, n := range names {
+		if body := getBody(t, ts.URL+"/"+n); body != n {
+			t.Errorf("expected mock %v to respond with its name found:%v", n, body)
+		}
+	}
+}
+
+func TestConfigRejectsAdminPaths(t *testing.T) {
+	_, err := LoadConfigFromBytes([]byte(`
+	server {
+		listen_addr = "localhost:5000"
+		mock "sneaky" {
+			request {
+				path = "/__mockaroo/mocks"
+				verb = "GET"
+			}
+			response {
+				body = "world"
+			}
+		}
+	}
+	`))
+	assertInvalidConfigError(t, err)
+}
+
+func TestAdminWithoutServerConfig(t *testing.T) {
+	handler := NewServer(&Config{}).(http.Handler)
+	calls := []struct{ method, path string }{
+		{http.MethodGet, adminMocksPath},
+		{http.MethodGet, adminMocksPath + "/hello"},
+		{http.MethodPost, adminMocksPath},
+		{http.MethodDelete, adminMocksPath + "/hello"},
+		{http.MethodPost, adminSequenceResetPath},
+		{http.MethodGet, adminRequestsPath},
+	}
+	for _, call := range calls {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(call.method, call.path, bytes.NewBufferString("{}")))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("%v %v expected 500 without a server config found:%v", call.method, call.path, rec.Code)
+		}
+	}
+}
+
+func adminCall(t *testing.T, method, url, body string) int {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("cannot create new request error:%v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("admin call %v %v failed with error:%v", method, url, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
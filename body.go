@@ -0,0 +1,231 @@
+package mockaroo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+//BodyMatcher matches requests on their body, every matcher that is set has to match
+type BodyMatcher struct {
+	Equals     *string           `hcl:"equals" json:"equals,omitempty"`                // the exact body
+	Matches    *string           `hcl:"matches" json:"matches,omitempty"`              // regexp the body should match
+	JSONEquals *string           `hcl:"json_equals" json:"json_equals,omitempty"`      // JSON equal to the body ignoring key order
+	JSONPath   map[string]string `hcl:"json_path,optional" json:"json_path,omitempty"` // regexp for the value at each path
+	JSONSchema *string           `hcl:"json_schema" json:"json_schema,omitempty"`      // JSON schema the body should be valid for
+
+	matches    *regexp.Regexp
+	jsonEquals interface{}
+	jsonPaths  []*jsonPathMatcher
+	schema     *gojsonschema.Schema
+}
+
+//jsonPathMatcher matches the value found at path against a regexp
+type jsonPathMatcher struct {
+	path  string
+	steps []jsonPathStep
+	value *regexp.Regexp
+}
+
+//jsonPathStep is either an object key or an array index
+type jsonPathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+//validateBodyMatcher compiles everything the body matcher of mock needs
+func validateBodyMatcher(fp string, mock *Mock, bm *BodyMatcher) error {
+	if bm.Matches != nil {
+		re, err := regexp.Compile(*bm.Matches)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid body matches regexp %s in mock \"%s\"", *bm.Matches, mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		bm.matches = re
+	}
+
+	if bm.JSONEquals != nil {
+		if err := json.Unmarshal([]byte(*bm.JSONEquals), &bm.jsonEquals); err != nil {
+			errMsg := fmt.Sprintf("invalid body json_equals in mock \"%s\" error:%v", mock.Name, err)
+			return invalidConfErr(fp, errMsg)
+		}
+	}
+
+	bm.jsonPaths = nil
+	for path, value := range bm.JSONPath {
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid body json_path \"%s\" in mock \"%s\" error:%v", path, mock.Name, err)
+			return invalidConfErr(fp, errMsg)
+		}
+		re, err := regexp.Compile(value)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid body json_path regexp %s key:\"%s\" in mock \"%s\"", value, path, mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		bm.jsonPaths = append(bm.jsonPaths, &jsonPathMatcher{path: path, steps: steps, value: re})
+	}
+
+	if bm.JSONSchema != nil {
+		schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(*bm.JSONSchema))
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid body json_schema in mock \"%s\" error:%v", mock.Name, err)
+			return invalidConfErr(fp, errMsg)
+		}
+		bm.schema = schema
+	}
+	return nil
+}
+
+//parseJSONPath parses paths like $.user.name, items[0].id or $["a.b"]
+//into steps, the leading $ is optional
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimSpace(path)
+	rest := strings.TrimPrefix(path, "$")
+	if rest == path && rest != "" && rest[0] != '[' {
+		// a path without the leading $ starts straight with a key
+		rest = "." + rest
+	}
+
+	var steps []jsonPathStep
+
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key")
+			}
+			steps = append(steps, jsonPathStep{key: rest[:end]})
+			rest = rest[end:]
+
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("missing ]")
+			}
+			inside := rest[1:end]
+			rest = rest[end+1:]
+			if unquoted, err := strconv.Unquote(strings.Replace(inside, "'", "\"", -1)); err == nil {
+				steps = append(steps, jsonPathStep{key: unquoted})
+				continue
+			}
+			i, err := strconv.Atoi(inside)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("index \"%s\" is not a quoted key or a number >= 0", inside)
+			}
+			steps = append(steps, jsonPathStep{index: i, isIndex: true})
+
+		default:
+			return nil, fmt.Errorf("unexpected \"%c\"", rest[0])
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("path has no keys")
+	}
+	return steps, nil
+}
+
+//lookup finds the value at the path in the decoded JSON doc
+func (jp *jsonPathMatcher) lookup(doc interface{}) (interface{}, bool) {
+	for _, step := range jp.steps {
+		if step.isIndex {
+			arr, ok := doc.([]interface{})
+			if !ok || step.index >= len(arr) {
+				return nil, false
+			}
+			doc = arr[step.index]
+			continue
+		}
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = obj[step.key]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+//jsonValueString is the text matched against json_path regexps, strings
+//as they are and everything else as JSON
+func jsonValueString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+//match checks body against every matcher that is set
+func (bm *BodyMatcher) match(body []byte) bool {
+	if bm.Equals != nil && string(body) != *bm.Equals {
+		return false
+	}
+
+	if bm.matches != nil && !bm.matches.Match(body) {
+		return false
+	}
+
+	if bm.JSONEquals != nil || len(bm.jsonPaths) > 0 {
+		var doc interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		if err := dec.Decode(&doc); err != nil {
+			return false
+		}
+
+		if bm.JSONEquals != nil && !reflect.DeepEqual(doc, bm.jsonEquals) {
+			return false
+		}
+
+		for _, jp := range bm.jsonPaths {
+			v, found := jp.lookup(doc)
+			if !found || !jp.value.MatchString(jsonValueString(v)) {
+				return false
+			}
+		}
+	}
+
+	if bm.schema != nil {
+		result, err := bm.schema.Validate(gojsonschema.NewBytesLoader(body))
+		if err != nil || !result.Valid() {
+			return false
+		}
+	}
+	return true
+}
+
+//bodyMatcher matches requests whose body matches bm
+func bodyMatcher(bm *BodyMatcher) mux.MatcherFunc {
+	return func(req *http.Request, rm *mux.RouteMatch) bool {
+		return bm.match(requestBody(req))
+	}
+}
+
+//requestBody reads the body of req and puts back a fresh reader so other
+//matchers and the handler can read it again
+func requestBody(req *http.Request) []byte {
+	if req.Body == nil {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body
+}
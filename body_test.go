@@ -0,0 +1,195 @@
+package mockaroo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const bodyTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	mock "exact" {
+		request {
+			path = "/exact"
+			verb = "POST"
+			body {
+				equals = "ping"
+			}
+		}
+		response {
+			body = "pong"
+		}
+	}
+
+	mock "regex" {
+		request {
+			path = "/exact"
+			verb = "POST"
+			body {
+				matches = "^p[aeiou]ng$"
+			}
+		}
+		response {
+			body = "regex"
+		}
+	}
+
+	mock "json_equal" {
+		request {
+			path = "/users"
+			verb = "POST"
+			body {
+				json_equals = <<EOF
+				{"name": "bob", "tags": ["a", "b"], "age": 42}
+				EOF
+			}
+		}
+		response {
+			body = "bob created"
+		}
+	}
+
+	mock "json_path" {
+		request {
+			path = "/users"
+			verb = "POST"
+			body {
+				json_path = {
+					"$.name" = "^alice$"
+					"address.zip" = "^9[0-9]{4}$"
+					"tags[1]" = "admin"
+					"age" = "^3[0-9]$"
+				}
+			}
+		}
+		response {
+			body = "alice created"
+		}
+	}
+
+	mock "schema" {
+		request {
+			path = "/orders"
+			verb = "POST"
+			body {
+				json_schema = <<EOF
+				{
+					"type": "object",
+					"required": ["id", "items"],
+					"properties": {
+						"id": {"type": "integer"},
+						"items": {"type": "array", "minItems": 1}
+					}
+				}
+				EOF
+			}
+		}
+		response {
+			status = 201
+			body = "order created {{index .JsonBody \"id\"}}"
+		}
+	}
+}
+`
+
+func TestBodyMatching(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(bodyTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	s := &muxServer{conf: conf}
+	s.router = s.newRouter(conf)
+
+	tests := []struct {
+		path     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"/exact", "ping", http.StatusOK, "pong"},
+		{"/exact", "pong", http.StatusOK, "regex"},
+		{"/exact", "pinged", http.StatusNotFound, ""},
+		// key order and whitespace do not matter for JSON equality
+		{"/users", `{"age": 42, "tags": ["a", "b"], "name": "bob"}`, http.StatusOK, "bob created"},
+		{"/users", `{"age": 42, "tags": ["b", "a"], "name": "bob"}`, http.StatusNotFound, ""},
+		{"/users", `{"name": "alice", "age": 35, "tags": ["dev", "admin"], "address": {"zip": "94105"}}`, http.StatusOK, "alice created"},
+		{"/users", `{"name": "alice", "age": 35, "tags": ["dev"], "address": {"zip": "94105"}}`, http.StatusNotFound, ""},
+		{"/users", `not json`, http.StatusNotFound, ""},
+		{"/orders", `{"id": 7, "items": [{"sku": "x"}]}`, http.StatusCreated, "order created 7"},
+		{"/orders", `{"id": "7", "items": [{"sku": "x"}]}`, http.StatusNotFound, ""},
+		{"/orders", `{"id": 7, "items": []}`, http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, test.path, bytes.NewBufferString(test.body))
+		rr := httptest.NewRecorder()
+		s.router.ServeHTTP(rr, req)
+
+		if rr.Code != test.status {
+			t.Errorf("POST %v %v expected status %v found:%v", test.path, test.body, test.status, rr.Code)
+			continue
+		}
+		body, _ := ioutil.ReadAll(rr.Body)
+		if test.expected != "" && strings.TrimSpace(string(body)) != test.expected {
+			t.Errorf("POST %v %v expected body %v found:%s", test.path, test.body, test.expected, body)
+		}
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	valid := map[string][]jsonPathStep{
+		"$.a.b":      {{key: "a"}, {key: "b"}},
+		"a.b":        {{key: "a"}, {key: "b"}},
+		"a[2].b":     {{key: "a"}, {index: 2, isIndex: true}, {key: "b"}},
+		`$["a.b"]`:   {{key: "a.b"}},
+		"$['x'][0]":  {{key: "x"}, {index: 0, isIndex: true}},
+		"$[1]":       {{index: 1, isIndex: true}},
+		"items[10]":  {{key: "items"}, {index: 10, isIndex: true}},
+		"$.user.id ": {{key: "user"}, {key: "id"}},
+	}
+	for path, expected := range valid {
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			t.Errorf("expected path %q to parse found error:%v", path, err)
+			continue
+		}
+		if len(steps) != len(expected) {
+			t.Errorf("expected path %q to have steps %v found:%v", path, expected, steps)
+			continue
+		}
+		for i := range steps {
+			if steps[i] != expected[i] {
+				t.Errorf("expected path %q to have steps %v found:%v", path, expected, steps)
+			}
+		}
+	}
+
+	for _, path := range []string{"$", "", "a..b", "a[x]", "a[-1]", "a[0", "$a"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("expected path %q to fail parsing", path)
+		}
+	}
+}
+
+func TestInvalidBodyMatcherConfigs(t *testing.T) {
+	invalid := map[string]string{
+		"bad regexp":      `matches = "("`,
+		"bad json":        `json_equals = "{"`,
+		"bad path":        `json_path = { "a[x]" = "1" }`,
+		"bad path regexp": `json_path = { "a" = "(" }`,
+		"bad schema":      `json_schema = "{\"type\": 7}"`,
+	}
+
+	for name, body := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\nmock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"POST\"\nbody {\n" + body + "\n}\n}\n" +
+			"response {\nbody = \"a\"\n}\n}\n}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil || !strings.Contains(err.Error(), "mock \"m\"") {
+			t.Errorf("%v: expected config load to fail for mock m found:%v", name, err)
+		}
+	}
+}
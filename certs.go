@@ -0,0 +1,200 @@
+package mockaroo
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// how long generated certificates are valid for
+	certValidity = 365 * 24 * time.Hour
+
+	// generated certificates are valid from a little while ago to allow for clock skew
+	certBackdate = time.Hour
+
+	// the CA certificate is public, anyone can read it
+	caFileMode = os.FileMode(0644)
+)
+
+// hosts generated certificates are issued for when none are configured
+var defaultCertHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+//Certificates are PEM encoded certificates and keys generated for HTTPS, Cert
+//is signed by CACert which is what clients need to trust
+type Certificates struct {
+	CACert []byte
+	CAKey  []byte
+	Cert   []byte
+	Key    []byte
+}
+
+//GenerateCertificates generates a CA and a certificate signed by it for hosts,
+//hosts can be DNS names or IPs, the defaults are used if hosts is empty
+func GenerateCertificates(hosts []string) (*Certificates, error) {
+	ca, err := newCertAuthority()
+	if err != nil {
+		return nil, err
+	}
+	cert, key, err := ca.issue(hosts)
+	if err != nil {
+		return nil, err
+	}
+	caKey, err := encodeKey(ca.key)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificates{CACert: ca.certPEM, CAKey: caKey, Cert: cert, Key: key}, nil
+}
+
+//certAuthority is a CA generated in memory to sign server certificates
+type certAuthority struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+func newCertAuthority() (*certAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating CA key: %w", err)
+	}
+
+	tmpl, err := certTemplate("mockaroo CA")
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CA certificate: %w", err)
+	}
+
+	return &certAuthority{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+	}, nil
+}
+
+//issue creates a server certificate for hosts signed by the CA and returns
+//it along with its key PEM encoded
+func (ca *certAuthority) issue(hosts []string) ([]byte, []byte, error) {
+	if len(hosts) == 0 {
+		hosts = defaultCertHosts
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating key: %w", err)
+	}
+
+	tmpl, err := certTemplate(hosts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating certificate: %w", err)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+//issueTLS is issue for a certificate that can be served right away
+func (ca *certAuthority) issueTLS(hosts []string) (tls.Certificate, error) {
+	cert, key, err := ca.issue(hosts)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(cert, key)
+}
+
+//setupAutoTLS issues certificates for the listeners with tls auto, all of
+//them signed by one CA generated for the server which is written out to
+//the ca_out files of the listeners
+func (s *muxServer) setupAutoTLS(listeners []*Listener) error {
+	for _, l := range listeners {
+		if l.TLS == nil || !l.TLS.Auto {
+			continue
+		}
+
+		if s.ca == nil {
+			ca, err := newCertAuthority()
+			if err != nil {
+				return err
+			}
+			s.ca = ca
+			s.autoCerts = make(map[string]tls.Certificate)
+		}
+
+		cert, err := s.ca.issueTLS(l.TLS.Hosts)
+		if err != nil {
+			return fmt.Errorf("error generating certificate for listener \"%v\": %w", l.Name, err)
+		}
+		s.autoCerts[l.Name] = cert
+
+		if l.TLS.CAOut != nil {
+			if err := ioutil.WriteFile(*l.TLS.CAOut, s.ca.certPEM, caFileMode); err != nil {
+				return fmt.Errorf("error writing CA of listener \"%v\" to %v: %w", l.Name, *l.TLS.CAOut, err)
+			}
+			log.Infof("wrote CA of the generated certificate of listener \"%v\" to %v", l.Name, *l.TLS.CAOut)
+		}
+	}
+	return nil
+}
+
+//certTemplate is the template for a certificate with a random serial number
+func certTemplate(commonName string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating serial number: %w", err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"mockaroo"}},
+		NotBefore:    now.Add(-certBackdate),
+		NotAfter:     now.Add(certValidity),
+	}, nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,135 @@
+package mockaroo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCertificates(t *testing.T) {
+	certs, err := GenerateCertificates([]string{"api.local", "10.1.2.3"})
+	if err != nil {
+		t.Fatalf("certificate generation failed with error:%v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(certs.CACert) {
+		t.Fatalf("expected CA certificate PEM found:%s", certs.CACert)
+	}
+	if _, err := tls.X509KeyPair(certs.CACert, certs.CAKey); err != nil {
+		t.Errorf("expected CA key to match the CA certificate found:%v", err)
+	}
+	if _, err := tls.X509KeyPair(certs.Cert, certs.Key); err != nil {
+		t.Errorf("expected key to match the certificate found:%v", err)
+	}
+
+	block, _ := pem.Decode(certs.Cert)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("cannot parse generated certificate error:%v", err)
+	}
+	for _, host := range []string{"api.local", "10.1.2.3"} {
+		opts := x509.VerifyOptions{DNSName: host, Roots: pool}
+		if _, err := cert.Verify(opts); err != nil {
+			t.Errorf("expected certificate to verify for %v found:%v", host, err)
+		}
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: pool}); err == nil {
+		t.Errorf("expected certificate not to verify for localhost")
+	}
+}
+
+const autoTLSTestConfig = `
+server {
+	listener "secure" {
+		listen_addr = "localhost:5443"
+		tls {
+			auto   = true
+			ca_out = "%s"
+		}
+	}
+
+	mock "hello" {
+		request {
+			path = "/hello"
+			verb = "GET"
+		}
+		response {
+			body = "hello over {{if .ClientCert}}mTLS{{else}}TLS{{end}}"
+		}
+	}
+}
+`
+
+func TestAutoTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auto_tls_test")
+	if err != nil {
+		t.Fatalf("cannot create temp dir error:%v", err)
+	}
+	defer os.RemoveAll(dir)
+	caOut := filepath.Join(dir, "ca.pem")
+
+	conf, err := LoadConfigFromBytes([]byte(fmt.Sprintf(autoTLSTestConfig, caOut)))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+	if !strings.HasPrefix(ts.URL, "https://127.0.0.1:") {
+		t.Fatalf("expected https URL found:%v", ts.URL)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/hello")
+	if err != nil {
+		t.Fatalf("request with test server client failed with error:%v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.TrimSpace(string(body)) != "hello over TLS" {
+		t.Errorf("expected body:hello over TLS found:%q", body)
+	}
+
+	// clients trusting the written CA can talk to the server
+	caPEM, err := ioutil.ReadFile(caOut)
+	if err != nil {
+		t.Fatalf("expected CA to be written to %v found:%v", caOut, err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPEM)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err = client.Get(ts.URL + "/hello")
+	if err != nil {
+		t.Fatalf("request trusting the written CA failed with error:%v", err)
+	}
+	resp.Body.Close()
+
+	// clients trusting only the system roots cannot
+	if resp, err := http.Get(ts.URL + "/hello"); err == nil {
+		resp.Body.Close()
+		t.Errorf("expected request not trusting the generated CA to fail")
+	}
+}
+
+func TestInvalidAutoTLSConfigs(t *testing.T) {
+	mock := "mock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n}\nresponse {\nbody = \"a\"\n}\n}\n"
+	invalid := map[string]string{
+		"auto with cert": "listen_addr = \"localhost:5443\"\nsnake_oil_cert = \"a.crt\"\nsnake_oil_key = \"a.key\"\ntls {\nauto = true\n}",
+		"hosts no auto":  "listen_addr = \"localhost:5000\"\ntls {\nhosts = [\"localhost\"]\n}",
+		"ca_out no auto": "listen_addr = \"localhost:5000\"\ntls {\nca_out = \"ca.pem\"\n}",
+		"empty host":     "listen_addr = \"localhost:5443\"\ntls {\nauto = true\nhosts = [\"\"]\n}",
+		"tls no address": "listener \"a\" {\nlisten_addr = \"localhost:5001\"\n}\ntls {\nauto = true\n}",
+	}
+
+	for name, server := range invalid {
+		src := "server {\n" + server + "\n" + mock + "}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil {
+			t.Errorf("%v: expected config load to fail", name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/subranag/mockaroo"
+)
+
+const (
+	// name of the subcommand that generates certificates
+	certCommand = "cert"
+
+	// certificates are public, keys are only for the owner
+	certFileMode = os.FileMode(0644)
+	keyFileMode  = os.FileMode(0600)
+)
+
+// runCert generates a CA and a certificate signed by it into a directory,
+// the certificate and key can be used as snake_oil_cert and snake_oil_key
+func runCert(args []string) int {
+	fs := flag.NewFlagSet(certCommand, flag.ExitOnError)
+	hosts := fs.String("hosts", "localhost,127.0.0.1,::1", "comma separated DNS names and IPs the certificate is for")
+	out := fs.String("out", ".", "the directory ca.crt, ca.key, server.crt and server.key are written to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: mockaroo %s [-hosts localhost,127.0.0.1] [-out dir]\n", certCommand)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var names []string
+	for _, h := range strings.Split(*hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			names = append(names, h)
+		}
+	}
+
+	certs, err := mockaroo.GenerateCertificates(names)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error generating certificates: %v\n", err)
+		return 1
+	}
+
+	files := []struct {
+		name    string
+		content []byte
+		mode    os.FileMode
+	}{
+		{"ca.crt", certs.CACert, certFileMode},
+		{"ca.key", certs.CAKey, keyFileMode},
+		{"server.crt", certs.Cert, certFileMode},
+		{"server.key", certs.Key, keyFileMode},
+	}
+	for _, f := range files {
+		path := filepath.Join(*out, f.name)
+		if err := ioutil.WriteFile(path, f.content, f.mode); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing %v: %v\n", path, err)
+			return 1
+		}
+		fmt.Println("wrote", path)
+	}
+	return 0
+}
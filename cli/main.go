@@ -1,32 +1,112 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/subranag/mockaroo"
 )
 
 func main() {
-	mockConfig := flag.String("conf", "", "the mockaroo config file")
+	if len(os.Args) > 1 && os.Args[1] == certCommand {
+		os.Exit(runCert(os.Args[2:]))
+	}
+
+	mockConfig := flag.String("conf", "", "the mockaroo config file, a directory or a glob of config files")
+	watch := flag.Bool("watch", false, "reload the mocks when the config or response files change")
+	watchInterval := flag.Duration("watch_interval", time.Second, "how often to check for changes in -watch mode")
+	shutdownTimeout := flag.Duration("shutdown_timeout", 10*time.Second, "max time to drain in-flight requests on shutdown")
+	record := flag.Bool("record", false, "proxy unmatched requests to -upstream and record them as mocks")
+	upstream := flag.String("upstream", "", "the upstream URL requests are proxied to in -record mode")
+	recordOut := flag.String("record_out", "recorded.hcl", "the HCL file recorded mocks are written to in -record mode")
+	listenAddr := flag.String("listen_addr", "localhost:5000", "the address to listen on in -record mode when no -conf is given")
 	flag.Parse()
 
-	if len(*mockConfig) == 0 {
+	if len(*mockConfig) == 0 && !*record {
 		flag.Usage()
 		os.Exit(2)
 	}
 
 	// parse config
-	conf, err := mockaroo.LoadConfig(mockConfig)
+	conf, err := loadRecordConfig(*mockConfig, *record, *upstream, *recordOut, *listenAddr)
 	if err != nil {
 		log.Fatalf("error loading config :%v", err)
 		os.Exit(2)
 	}
 	s := mockaroo.NewServer(conf)
 
-	if err := s.Start(); err != nil {
-		log.Fatalf("error starting server :%v", err)
-		os.Exit(2)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Start()
+	}()
+
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if *watch {
+		go mockaroo.WatchConfig(watchCtx, s, conf, func() (*mockaroo.Config, error) {
+			return loadConfig(*mockConfig)
+		}, *watchInterval)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			log.Fatalf("error starting server :%v", err)
+			os.Exit(2)
+		}
+	case sig := <-sigs:
+		log.Infof("received signal %v", sig)
+		stopWatch()
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+
+		if err := s.Shutdown(ctx); err != nil {
+			log.Errorf("error shutting down server :%v", err)
+			os.Exit(1)
+		}
+
+		// wait for Start to return so that nothing is left behind
+		if err := <-errs; err != nil {
+			log.Errorf("error stopping server :%v", err)
+			os.Exit(1)
+		}
+		log.Info("mockaroo shut down cleanly")
+	}
+}
+
+// loadConfig loads a single config file or merges all files in a directory/glob
+func loadConfig(path string) (*mockaroo.Config, error) {
+	if fi, err := os.Stat(path); (err == nil && fi.IsDir()) || strings.ContainsAny(path, "*?[") {
+		return mockaroo.LoadConfigGlob(path)
+	}
+	return mockaroo.LoadConfig(&path)
+}
+
+// loadRecordConfig loads the config and turns on record mode if asked to, in record
+// mode the config is optional and mockaroo can start off with no mocks at all
+func loadRecordConfig(path string, record bool, upstream, out, listenAddr string) (*mockaroo.Config, error) {
+	if !record {
+		return loadConfig(path)
+	}
+
+	if path == "" {
+		src := fmt.Sprintf("server {\n listen_addr = %q\n record {\n upstream = %q\n out = %q\n }\n}\n", listenAddr, upstream, out)
+		return mockaroo.LoadConfigFromBytes([]byte(src))
+	}
+
+	conf, err := loadConfig(path)
+	if err != nil {
+		return nil, err
 	}
+	return conf, conf.EnableRecording(upstream, out)
 }
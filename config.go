@@ -3,14 +3,23 @@ package mockaroo
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 	"text/template"
 
-	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -24,6 +33,16 @@ const (
 const (
 	listenAddrField = "listen_addr"
 	maxPortNum      = 65353
+
+	// pseudo file names used in errors for configs not loaded from a file
+	bytesConfigName  = "<bytes>"
+	readerConfigName = "<reader>"
+
+	// files picked up when a directory is given to LoadConfigGlob
+	configDirGlob = "*.hcl"
+
+	// name used for the default response in logs and errors
+	defaultResponseName = "default_response"
 )
 
 var validVerbs = map[string]interface{}{
@@ -44,6 +63,11 @@ type Config struct {
 	// used only in this package
 	configFilePath *string
 
+	// files and directories the config was loaded from and how they
+	// looked when loaded, used to watch for changes
+	sourceFiles []string
+	loadStamps  map[string]fileStamp
+
 	ServerConfig *ServerConf `hcl:"server,block"`
 }
 
@@ -56,47 +80,125 @@ func (c *Config) String() string {
 
 //ServerConf mockaroo server configuration
 type ServerConf struct {
-	ListenAddr       *string `hcl:"listen_addr"`
-	SnakeOilCertPath *string `hcl:"snake_oil_cert"`
-	SnakeOilKeyPath  *string `hcl:"snake_oil_key"`
-	RequestLogPath   *string `hcl:"request_log_path"`
-	Mocks            []*Mock `hcl:"mock,block"`
+	ListenAddr       *string     `hcl:"listen_addr"`
+	SnakeOilCertPath *string     `hcl:"snake_oil_cert"`
+	SnakeOilKeyPath  *string     `hcl:"snake_oil_key"`
+	TLS              *TLSConf    `hcl:"tls,block"` // TLS settings for listen_addr
+	Protocol         *string     `hcl:"protocol"`  // protocol served on listen_addr, auto, http1 or http2
+	RequestLogPath   *string     `hcl:"request_log_path"`
+	JournalSize      *int        `hcl:"journal_size"` // number of requests kept in memory
+	Record           *RecordConf `hcl:"record,block"`
+	ProxyFallback    *string     `hcl:"proxy_fallback"`         // unmatched requests are forwarded here
+	RandomSeed       *int64      `hcl:"random_seed"`            // seeds the choice of weighted responses and delays
+	Delay            *Delay      `hcl:"delay,block"`            // default delay for mocks without one
+	DefaultResponse  *Response   `hcl:"default_response,block"` // sent for requests no mock matched
+	Listeners        []*Listener `hcl:"listener,block"`
+	Mocks            []*Mock     `hcl:"mock,block"`
+	GRPC             *GRPCConf   `hcl:"grpc,block"` // descriptor sets of the services grpc mocks answer for
+	GRPCMocks        []*GRPCMock `hcl:"grpc_mock,block"`
 	Mode             ServerMode
+
+	proxyFallbackURL *url.URL
+	listeners        []*Listener // all listeners including the "default" one
+	defaultMock      *Mock       // holds DefaultResponse once validated
+}
+
+//RecordConf turns on record mode, requests that do not match any mock are
+//proxied to Upstream and every request/response pair is written out as a
+//mock block to the HCL file Out
+type RecordConf struct {
+	Upstream *string `hcl:"upstream"`
+	Out      *string `hcl:"out"`
+
+	upstreamURL *url.URL
+}
+
+//journalSize is the configured journal size or the default if not configured
+func (sc *ServerConf) journalSize() int {
+	if sc.JournalSize == nil {
+		return defaultJournalSize
+	}
+	return *sc.JournalSize
+}
+
+//randomSeed is the configured random seed or the default if not configured
+func (sc *ServerConf) randomSeed() int64 {
+	if sc.RandomSeed == nil {
+		return nicePrime
+	}
+	return *sc.RandomSeed
 }
 
 //Mock matches a specific request and lays out how to generate a response
 //to the request
 type Mock struct {
-	Name     string    `hcl:"name,label"`
-	Request  *Request  `hcl:"request,block"`
-	Response *Response `hcl:"response,block"`
+	Name     string    `hcl:"name,label" json:"name"`
+	Priority int       `hcl:"priority,optional" json:"priority,omitempty"` // higher priority mocks are tried first
+	Scenario *Scenario `hcl:"scenario,block" json:"scenario,omitempty"`
+	Request  *Request  `hcl:"request,block" json:"request"`
+
+	// several responses are served one after the other on successive calls
+	Responses []*Response `hcl:"response,block" json:"responses,omitempty"`
+	Sequence  *string     `hcl:"sequence" json:"sequence,omitempty"` // what happens after the last response
+
+	// the first of Responses, a single response can also be sent as JSON in it
+	Response *Response `json:"response,omitempty"`
+
+	// file:line where the mock was declared, empty if not known
+	location string
+
+	// sum of the response weights, responses are picked at random when > 0
+	totalWeight int
+}
+
+//MarshalJSON writes a single response as response and several as responses,
+//the same shapes the admin API accepts
+func (m Mock) MarshalJSON() ([]byte, error) {
+	type plainMock Mock
+	out := plainMock(m)
+	if len(out.Responses) <= 1 {
+		out.Responses = nil
+	} else {
+		out.Response = nil
+	}
+	return json.Marshal(out)
 }
 
 //Request encapsulates a mock request with all information to match a specific
 //request
 type Request struct {
-	Path           *string `hcl:"path"`
-	NormalizedPath string
-	PathPrefix     bool              // should this path be a prefix formulated from the Path
-	Verb           *string           `hcl:"verb"`
-	Headers        map[string]string `hcl:"headers,optional"` // request match headers
-	Queries        map[string]string `hcl:"queries,optional"` // query match headers
+	Path           *string            `hcl:"path" json:"path"`
+	NormalizedPath string             `json:"-"`
+	PathPrefix     bool               `json:"-"` // should this path be a prefix formulated from the Path
+	Verb           *string            `hcl:"verb" json:"verb"`
+	Headers        map[string]string  `hcl:"headers,optional" json:"headers,omitempty"` // request match headers
+	Queries        map[string]string  `hcl:"queries,optional" json:"queries,omitempty"` // query match headers
+	Form           map[string]string  `hcl:"form,optional" json:"form,omitempty"`       // form field match regexps
+	Files          []*FileMatcher     `hcl:"file,block" json:"files,omitempty"`         // multipart uploads to match
+	Body           *BodyMatcher       `hcl:"body,block" json:"body,omitempty"`
+	Host           *string            `hcl:"host" json:"host,omitempty"`                          // host with "*" wildcards or gorilla host template
+	Scheme         *string            `hcl:"scheme" json:"scheme,omitempty"`                      // http or https
+	ClientCIDRs    []string           `hcl:"client_cidrs,optional" json:"client_cidrs,omitempty"` // networks or IPs requests can come from
+	ClientCert     *ClientCertMatcher `hcl:"client_cert,block" json:"client_cert,omitempty"`
+	Protocol       *string            `hcl:"protocol" json:"protocol,omitempty"` // http1 or http2
+
+	clientNets []*net.IPNet
 }
 
 //Response encapsulates a complete mock response to a mock Request
 type Response struct {
-	Status       int               `hcl:"status,optional"`
-	ResponseBody *string           `hcl:"body"`
-	ResponseFile *string           `hcl:"file"`
-	Headers      map[string]string `hcl:"headers,optional"`
-	Delay        *Delay            `hcl:"delay,block"`
-	Template     *template.Template
-	Content      []byte
-}
-
-type Delay struct {
-	MaxMillis int64 `hcl:"max_millis"`
-	MinMillis int64 `hcl:"min_millis"`
+	Status       int                `hcl:"status,optional" json:"status,omitempty"`
+	ResponseBody *string            `hcl:"body" json:"body,omitempty"`
+	ResponseFile *string            `hcl:"file" json:"file,omitempty"`
+	Headers      map[string]string  `hcl:"headers,optional" json:"headers,omitempty"`
+	Delay        *Delay             `hcl:"delay,block" json:"delay,omitempty"`
+	Proxy        *ProxyResponse     `hcl:"proxy,block" json:"proxy,omitempty"`
+	Repeat       int                `hcl:"repeat,optional" json:"repeat,omitempty"` // times served before moving on in a sequence
+	Weight       *int               `hcl:"weight" json:"weight,omitempty"`          // relative chance of being picked at random
+	Fault        *Fault             `hcl:"fault,block" json:"fault,omitempty"`
+	WebSocket    *WebSocketScript   `hcl:"websocket,block" json:"websocket,omitempty"` // upgrades the request and runs a script
+	Template     *template.Template `json:"-"`
+	Content      []byte             `json:"-"`
 }
 
 //InvalidConfigFile error is raised when given input hcl file fails validation
@@ -123,27 +225,259 @@ func LoadConfig(filePath *string) (*Config, error) {
 
 	log.Infof("config file : \"%v\"", *filePath)
 
+	src, err := ioutil.ReadFile(*filePath)
+	if err != nil {
+		return nil, &InvalidConfigFile{path: *filePath, message: err.Error()}
+	}
+
+	config, err := decodeConfig(*filePath, src)
+	if err != nil {
+		return nil, err
+	}
+	config.sourceFiles = []string{*filePath}
+
+	return finishConfig(*filePath, config)
+}
+
+//LoadConfigFromBytes loads the config from HCL source held in memory, this is
+//handy in tests where writing a temp file is a chore
+func LoadConfigFromBytes(src []byte) (*Config, error) {
+	config, err := decodeConfig(bytesConfigName, src)
+	if err != nil {
+		return nil, err
+	}
+	return finishConfig(bytesConfigName, config)
+}
+
+//LoadConfigFromReader loads the config from HCL source read fully from r
+func LoadConfigFromReader(r io.Reader) (*Config, error) {
+	if r == nil {
+		return nil, &InvalidConfigFile{path: readerConfigName, message: "nil config reader"}
+	}
+
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, &InvalidConfigFile{path: readerConfigName, message: err.Error()}
+	}
+
+	config, err := decodeConfig(readerConfigName, src)
+	if err != nil {
+		return nil, err
+	}
+	return finishConfig(readerConfigName, config)
+}
+
+//LoadConfigFiles loads several config files and merges them into one Config, mock
+//blocks from all the files are merged in the order of the files, every other server
+//setting (listen_addr, request_log_path etc.) can be set in at most one of the files
+func LoadConfigFiles(filePaths ...string) (*Config, error) {
+	return loadConfigFiles(nil, filePaths)
+}
+
+//loadConfigFiles is LoadConfigFiles watching dirs along with the files, the
+//dirs are added before the files are stamped so that watching starts off
+//from the same set of files the config reports
+func loadConfigFiles(dirs []string, filePaths []string) (*Config, error) {
+	if len(filePaths) == 0 {
+		return nil, &InvalidConfigFile{path: "", message: "no config files given"}
+	}
+
+	configs := make([]*Config, 0, len(filePaths))
+	for _, fp := range filePaths {
+		log.Infof("config file : \"%v\"", fp)
+
+		src, err := ioutil.ReadFile(fp)
+		if err != nil {
+			return nil, &InvalidConfigFile{path: fp, message: err.Error()}
+		}
+
+		config, err := decodeConfig(fp, src)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+
+	allPaths := strings.Join(filePaths, ",")
+	config, err := mergeConfigs(allPaths, filePaths, configs)
+	if err != nil {
+		return nil, err
+	}
+	config.sourceFiles = append(append([]string{}, filePaths...), dirs...)
+	return finishConfig(allPaths, config)
+}
+
+//LoadConfigGlob loads all config files matching the glob pattern (in lexical order)
+//and merges them as in LoadConfigFiles, if pattern is a directory all the "*.hcl"
+//files in the directory are loaded
+func LoadConfigGlob(pattern string) (*Config, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, &InvalidConfigFile{path: pattern, message: "empty config glob pattern"}
+	}
+
+	if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+		pattern = filepath.Join(pattern, configDirGlob)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, &InvalidConfigFile{path: pattern, message: err.Error()}
+	}
+
+	if len(matches) == 0 {
+		return nil, &InvalidConfigFile{path: pattern, message: "no config files match pattern"}
+	}
+
+	sort.Strings(matches)
+
+	// files added to or removed from the directory change its mod time
+	return loadConfigFiles([]string{filepath.Dir(pattern)}, matches)
+}
+
+// ALL UN-EXPORTED METHODS
+
+//watchFiles lists all the files a config depends on, the config files
+//themselves and every response file referenced by the mocks
+func (c *Config) watchFiles() []string {
+	files := append([]string{}, c.sourceFiles...)
+	if c.ServerConfig == nil {
+		return files
+	}
+	for _, m := range c.ServerConfig.Mocks {
+		for _, r := range m.Responses {
+			if r.ResponseFile != nil {
+				files = append(files, *r.ResponseFile)
+			}
+		}
+	}
+	if dr := c.ServerConfig.DefaultResponse; dr != nil && dr.ResponseFile != nil {
+		files = append(files, *dr.ResponseFile)
+	}
+	return files
+}
+
+//decodeConfig parses and decodes HCL (or HCL JSON if the file name ends with
+//.json) source into a Config, no validation is done here
+func decodeConfig(filePath string, src []byte) (*Config, error) {
+	parser := hclparse.NewParser()
+
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if strings.ToLower(filepath.Ext(filePath)) == ".json" {
+		file, diags = parser.ParseJSON(src, filePath)
+	} else {
+		file, diags = parser.ParseHCL(src, filePath)
+	}
+	if diags.HasErrors() {
+		return nil, &InvalidConfigFile{path: filePath, message: diags.Error()}
+	}
+
 	var config Config
+	if diags := gohcl.DecodeBody(file.Body, nil, &config); diags.HasErrors() {
+		return nil, &InvalidConfigFile{path: filePath, message: diags.Error()}
+	}
 
-	if err := hclsimple.DecodeFile(*filePath, nil, &config); err != nil {
-		return nil, &InvalidConfigFile{path: *filePath, message: err.Error()}
+	setMockLocations(file, &config)
+	return &config, nil
+}
+
+//setMockLocations remembers where every mock was declared so that errors can
+//point at the right file and line, only native HCL syntax carries locations
+func setMockLocations(file *hcl.File, config *Config) {
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok || config.ServerConfig == nil {
+		return
+	}
+
+	var ranges []hcl.Range
+	for _, sb := range body.Blocks {
+		if sb.Type != "server" {
+			continue
+		}
+		for _, mb := range sb.Body.Blocks {
+			if mb.Type == "mock" {
+				ranges = append(ranges, mb.DefRange())
+			}
+		}
 	}
 
+	// mocks are decoded in the same order as the blocks are declared
+	mocks := config.ServerConfig.Mocks
+	for i := 0; i < len(mocks) && i < len(ranges); i++ {
+		mocks[i].location = fmt.Sprintf("%s:%d", ranges[i].Filename, ranges[i].Start.Line)
+	}
+}
+
+//mergeConfigs merges configs decoded from filePaths into one config, mock and listener
+//blocks are appended in order and all other server settings can be set only once across files
+func mergeConfigs(allPaths string, filePaths []string, configs []*Config) (*Config, error) {
+	merged := &ServerConf{}
+	mv := reflect.ValueOf(merged).Elem()
+	mt := mv.Type()
+
+	// which file set a server setting first
+	setIn := make(map[string]string)
+
+	for i, c := range configs {
+		if c.ServerConfig == nil {
+			continue
+		}
+		cv := reflect.ValueOf(c.ServerConfig).Elem()
+
+		for f := 0; f < mt.NumField(); f++ {
+			tag := mt.Field(f).Tag.Get("hcl")
+			if tag == "" {
+				// not a config setting, computed during validation
+				continue
+			}
+
+			name := strings.Split(tag, ",")[0]
+			if name == "mock" {
+				merged.Mocks = append(merged.Mocks, c.ServerConfig.Mocks...)
+				continue
+			}
+			if name == "listener" {
+				merged.Listeners = append(merged.Listeners, c.ServerConfig.Listeners...)
+				continue
+			}
+			if name == "grpc_mock" {
+				merged.GRPCMocks = append(merged.GRPCMocks, c.ServerConfig.GRPCMocks...)
+				continue
+			}
+
+			fv := cv.Field(f)
+			if fv.IsZero() {
+				continue
+			}
+
+			if prev, present := setIn[name]; present {
+				errMsg := fmt.Sprintf("server setting \"%s\" set in %s and again in %s, it can be set in only one file", name, prev, filePaths[i])
+				return nil, invalidConfErr(allPaths, errMsg)
+			}
+			setIn[name] = filePaths[i]
+			mv.Field(f).Set(fv)
+		}
+	}
+
+	return &Config{ServerConfig: merged}, nil
+}
+
+//finishConfig runs all the logical validation on a decoded config
+func finishConfig(filePath string, config *Config) (*Config, error) {
 	log.Info("config file parsed about to validate...")
 
 	// config file parsed
-	config.configFilePath = filePath
+	config.configFilePath = &filePath
 
 	// all logical validation
 	if err := config.validateConfig(); err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	config.loadStamps = stampFiles(config.watchFiles())
+	return config, nil
 }
 
-// ALL UN-EXPORTED METHODS
-
 //validateConfig validate the root config object
 func (c *Config) validateConfig() error {
 
@@ -154,44 +488,67 @@ func (c *Config) validateConfig() error {
 	}
 	sc := c.ServerConfig
 
-	listenAddrRegex := regexp.MustCompile(`(?P<host>.+):(?P<port>\d+)`)
-	if sc.ListenAddr == nil || *sc.ListenAddr == "" {
-		errMsg := fmt.Sprintf("%s field in file null or empty", listenAddrField)
-		return invalidConfErr(fp, errMsg)
+	if err := validateListeners(fp, sc); err != nil {
+		return err
 	}
 
-	res := listenAddrRegex.FindStringSubmatch(*sc.ListenAddr)
-
-	if len(res) != 3 {
-		errMsg := fmt.Sprintf("expected field %s to be \"<server>:<port>\" found \"%s\"", listenAddrField, *sc.ListenAddr)
-		return invalidConfErr(fp, errMsg)
+	if c.ServerConfig.RequestLogPath == nil || strings.TrimSpace(*c.ServerConfig.RequestLogPath) == "" {
+		c.ServerConfig.RequestLogPath = nil
 	}
 
-	// not worried about err here see regex we match \d+
-	port, _ := strconv.Atoi(res[2])
-	if port < 0 || port > maxPortNum {
-		errMsg := fmt.Sprintf("port numbers can only be 0 < port < %v found %v in %s=%s", maxPortNum, port, listenAddrField, *sc.ListenAddr)
+	if sc.JournalSize != nil && *sc.JournalSize < 0 {
+		errMsg := fmt.Sprintf("journal_size should be >= 0 found %v", *sc.JournalSize)
 		return invalidConfErr(fp, errMsg)
 	}
-	log.Infof("will start server in address: %v", *sc.ListenAddr)
 
-	if c.ServerConfig.RequestLogPath == nil || strings.TrimSpace(*c.ServerConfig.RequestLogPath) == "" {
-		c.ServerConfig.RequestLogPath = nil
+	if sc.Delay != nil {
+		if err := validateDelay(fp, "server", sc.Delay); err != nil {
+			return err
+		}
 	}
 
-	// if key && cert are present then we can start in HTTPS mode
-	bothPresent := sc.SnakeOilCertPath != nil && sc.SnakeOilKeyPath != nil
+	mocks := c.ServerConfig.Mocks
 
-	sc.Mode = HTTP
-	log.Info("assuming default mode HTTP")
-	if bothPresent {
-		sc.Mode = HTTPS
-		log.Info("snake oil cert && key present will start in HTTPS mode")
+	if sc.Record != nil {
+		if err := validateRecord(fp, sc.Record); err != nil {
+			return err
+		}
 	}
 
-	mocks := c.ServerConfig.Mocks
+	if sc.ProxyFallback != nil {
+		u, err := parseUpstreamURL(fp, "proxy_fallback", *sc.ProxyFallback)
+		if err != nil {
+			return err
+		}
+		if sc.Record != nil {
+			return invalidConfErr(fp, "proxy_fallback and record cannot be used together, record mode already proxies to its upstream")
+		}
+		sc.proxyFallbackURL = u
+		log.Infof("unmatched requests will be forwarded to %v", u)
+	}
+
+	if dr := sc.DefaultResponse; dr != nil {
+		if sc.ProxyFallback != nil || sc.Record != nil {
+			return invalidConfErr(fp, "default_response cannot be used with proxy_fallback or record, they already answer unmatched requests")
+		}
 
-	if len(mocks) == 0 {
+		// unmatched requests are not found unless said otherwise
+		if dr.Status == 0 {
+			dr.Status = http.StatusNotFound
+		}
+		dm := &Mock{Name: defaultResponseName, Responses: []*Response{dr}, Response: dr}
+		if err := validateResponse(fp, dm, dr); err != nil {
+			return err
+		}
+		if dr.Weight != nil || dr.Repeat > 1 {
+			return invalidConfErr(fp, "weight and repeat cannot be used in default_response")
+		}
+		sc.defaultMock = dm
+	}
+
+	// in record mode it is fine to start off with no mocks at all,
+	// so is a server with only grpc mocks
+	if len(mocks) == 0 && len(sc.GRPCMocks) == 0 && sc.Record == nil {
 		return invalidConfErr(fp, "0 mocks configured, configure mocks using mock:{...} block")
 	}
 
@@ -208,109 +565,340 @@ func (c *Config) validateConfig() error {
 
 		prevIndex, present := nameToIndex[name]
 		if present {
-			errMsg := fmt.Sprintf("mock with name %v already exists in index %v duplicate in %v", name, prevIndex, i)
+			errMsg := fmt.Sprintf("mock with name %v already exists in %v duplicate in %v", name, mockLocation(mocks, prevIndex), mockLocation(mocks, i))
 			return invalidConfErr(fp, errMsg)
 		}
 		nameToIndex[name] = i
 
-		if mock.Request == nil {
-			errMsg := fmt.Sprintf("request section missing for mock \"%s\"", mock.Name)
+		if err := validateMock(fp, mock); err != nil {
+			return err
+		}
+
+		// mock looks good
+		log.Infof("mock:\"%v\" with path:\"%v\" validates successfully", mock.Name, *mock.Request.Path)
+	}
+	if err := validateListenerMocks(fp, sc.listeners, mocks, sc.GRPCMocks); err != nil {
+		return err
+	}
+	warnShadowedMocks(mocks, mockListeners(sc.listeners, mocks))
+
+	if err := validateGRPC(fp, sc, mocks); err != nil {
+		return err
+	}
+
+	// all validation passed we are kosher
+	return nil
+}
+
+//EnableRecording turns on record mode for an already loaded config, unmatched
+//requests are proxied to upstream and recorded as mocks in the HCL file out
+func (c *Config) EnableRecording(upstream, out string) error {
+	rc := &RecordConf{Upstream: &upstream, Out: &out}
+	fp := ""
+	if c.configFilePath != nil {
+		fp = *c.configFilePath
+	}
+	if err := validateRecord(fp, rc); err != nil {
+		return err
+	}
+	c.ServerConfig.Record = rc
+	return nil
+}
+
+//validateRecord validates the record block
+func validateRecord(fp string, rc *RecordConf) error {
+	if rc.Upstream == nil {
+		return invalidConfErr(fp, "record upstream cannot be nil/\"\"")
+	}
+
+	u, err := parseUpstreamURL(fp, "record upstream", *rc.Upstream)
+	if err != nil {
+		return err
+	}
+	rc.upstreamURL = u
+
+	if rc.Out == nil || strings.TrimSpace(*rc.Out) == "" {
+		return invalidConfErr(fp, "record out file cannot be nil/\"\"")
+	}
+	return nil
+}
+
+//parseUpstreamURL parses the URL of a proxy upstream, field is used in errors
+func parseUpstreamURL(fp, field, raw string) (*url.URL, error) {
+	if strings.TrimSpace(raw) == "" {
+		errMsg := fmt.Sprintf("%s cannot be nil/\"\"", field)
+		return nil, invalidConfErr(fp, errMsg)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errMsg := fmt.Sprintf("%s should be an absolute http(s) URL found \"%v\"", field, raw)
+		return nil, invalidConfErr(fp, errMsg)
+	}
+	return u, nil
+}
+
+//validateMock validates a single mock and prepares it for serving, this is
+//everything but checks across mocks like duplicate names
+func validateMock(fp string, mock *Mock) error {
+	if mock.Request == nil {
+		errMsg := fmt.Sprintf("request section missing for mock \"%s\"", mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if err := validatePath(fp, mock); err != nil {
+		return err
+	}
+
+	// validate verb
+	if mock.Request.Verb == nil || strings.TrimSpace(*mock.Request.Verb) == "" {
+		errMsg := fmt.Sprintf("null/missing/empty verb for mock \"%s\" verb can only be (GET|HEAD|POST|PUT|DELETE|CONNECT|OPTIONS|TRACE|PATCH)", mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if _, present := validVerbs[*mock.Request.Verb]; !present {
+		errMsg := fmt.Sprintf("invalid verb \"%v\" for mock \"%s\" verb can only be (GET|HEAD|POST|PUT|DELETE|CONNECT|OPTIONS|TRACE|PATCH)", *mock.Request.Verb, mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	// process headers
+	reqHeaders := mock.Request.Headers
+	for h, v := range reqHeaders {
+		_, err := regexp.Compile(v)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid request header regexp %s header:\"%s\" in mock \"%s\"", v, h, mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+	}
+
+	// process queries
+	reqQueries := mock.Request.Queries
+	for h, v := range reqQueries {
+		_, err := regexp.Compile(v)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid request query regexp %s key:\"%s\" in mock \"%s\"", v, h, mock.Name)
 			return invalidConfErr(fp, errMsg)
 		}
+	}
 
-		if err := validatePath(fp, mock); err != nil {
+	// mux rejects a route whose variables clash, e.g. a name used twice
+	// in the path and queries, such a route would never match
+	if err := mockRoute(mock).GetError(); err != nil {
+		errMsg := fmt.Sprintf("invalid request path or queries in mock \"%s\" error:%v", mock.Name, err)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if err := validateFormMatchers(fp, mock); err != nil {
+		return err
+	}
+
+	if err := validateHostMatchers(fp, mock); err != nil {
+		return err
+	}
+
+	if err := validateClientCertMatcher(fp, mock); err != nil {
+		return err
+	}
+
+	if err := validateProtocolMatcher(fp, mock); err != nil {
+		return err
+	}
+
+	if bm := mock.Request.Body; bm != nil {
+		if err := validateBodyMatcher(fp, mock, bm); err != nil {
 			return err
 		}
+	}
 
-		// validate verb
-		if mock.Request.Verb == nil || strings.TrimSpace(*mock.Request.Verb) == "" {
-			errMsg := fmt.Sprintf("null/missing/empty verb for mock \"%s\" verb can only be (GET|HEAD|POST|PUT|DELETE|CONNECT|OPTIONS|TRACE|PATCH)", mock.Name)
+	if sc := mock.Scenario; sc != nil {
+		if strings.TrimSpace(sc.Name) == "" {
+			errMsg := fmt.Sprintf("scenario name cannot be empty for mock \"%s\"", mock.Name)
 			return invalidConfErr(fp, errMsg)
 		}
 
-		if _, present := validVerbs[*mock.Request.Verb]; !present {
-			errMsg := fmt.Sprintf("invalid verb \"%v\" for mock \"%s\" verb can only be (GET|HEAD|POST|PUT|DELETE|CONNECT|OPTIONS|TRACE|PATCH)", *mock.Request.Verb, mock.Name)
+		if (sc.State != nil && strings.TrimSpace(*sc.State) == "") || (sc.NextState != nil && strings.TrimSpace(*sc.NextState) == "") {
+			errMsg := fmt.Sprintf("scenario state/next_state cannot be \"\" for mock \"%s\"", mock.Name)
 			return invalidConfErr(fp, errMsg)
 		}
+	}
 
-		// process headers
-		reqHeaders := mock.Request.Headers
-		for h, v := range reqHeaders {
-			_, err := regexp.Compile(v)
-			if err != nil {
-				errMsg := fmt.Sprintf("invalid request header regexp %s header:\"%s\" in mock \"%s\"", v, h, mock.Name)
-				return invalidConfErr(fp, errMsg)
-			}
+	// a single response sent as JSON comes in as response
+	if mock.Response != nil && len(mock.Responses) == 0 {
+		mock.Responses = []*Response{mock.Response}
+	}
+
+	if mock.Response != nil && mock.Response != mock.Responses[0] {
+		errMsg := fmt.Sprintf("only one of response/responses can be present for mock \"%s\"", mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if len(mock.Responses) == 0 {
+		errMsg := fmt.Sprintf("response section missing for mock \"%s\"", mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	for _, response := range mock.Responses {
+		if err := validateResponse(fp, mock, response); err != nil {
+			return err
 		}
+	}
+	mock.Response = mock.Responses[0]
 
-		// process queries
-		reqQueries := mock.Request.Queries
-		for h, v := range reqQueries {
-			_, err := regexp.Compile(v)
-			if err != nil {
-				errMsg := fmt.Sprintf("invalid request query regexp %s key:\"%s\" in mock \"%s\"", v, h, mock.Name)
-				return invalidConfErr(fp, errMsg)
-			}
+	if err := validateWeights(fp, mock); err != nil {
+		return err
+	}
+
+	if mock.Sequence != nil {
+		if _, present := validSequences[*mock.Sequence]; !present {
+			errMsg := fmt.Sprintf("invalid sequence \"%v\" for mock \"%s\" sequence can only be (%s|%s)", *mock.Sequence, mock.Name, SequenceStickOnLast, SequenceCycle)
+			return invalidConfErr(fp, errMsg)
 		}
+	}
 
-		if mock.Response == nil {
-			errMsg := fmt.Sprintf("response section missing for mock \"%s\"", mock.Name)
+	return nil
+}
+
+//validateWeights checks that either all or none of the responses of mock are
+//weighted, weighted responses are picked at random so they cannot be sequenced
+func validateWeights(fp string, mock *Mock) error {
+	mock.totalWeight = 0
+	weighted := 0
+	for _, response := range mock.Responses {
+		if response.Weight == nil {
+			continue
+		}
+		if *response.Weight < 0 {
+			errMsg := fmt.Sprintf("weight should be >= 0 found %v for mock \"%s\"", *response.Weight, mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		if response.Repeat > 1 {
+			errMsg := fmt.Sprintf("weight and repeat cannot be used together for mock \"%s\"", mock.Name)
 			return invalidConfErr(fp, errMsg)
 		}
+		weighted++
+		mock.totalWeight += *response.Weight
+	}
 
-		// if the response Status is set not present or set to 0
-		// just assume the response code is going to be success
-		if mock.Response.Status == 0 {
-			mock.Response.Status = 200
+	if weighted == 0 {
+		return nil
+	}
+
+	if weighted != len(mock.Responses) {
+		errMsg := fmt.Sprintf("either all or none of the responses should have a weight for mock \"%s\"", mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if mock.Sequence != nil {
+		errMsg := fmt.Sprintf("weight and sequence cannot be used together for mock \"%s\"", mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if mock.totalWeight == 0 {
+		errMsg := fmt.Sprintf("at least one response should have weight > 0 for mock \"%s\"", mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+	return nil
+}
+
+//validateResponse validates one of the responses of mock and prepares it for serving
+func validateResponse(fp string, mock *Mock, response *Response) error {
+	// if the response Status is set not present or set to 0
+	// just assume the response code is going to be success
+	if response.Status == 0 {
+		response.Status = 200
+	}
+
+	inValidRange := response.Status >= 100 && response.Status <= 599
+	// not in valid range
+	if !inValidRange {
+		errMsg := fmt.Sprintf("status code is %v, shoud be 100 <= status <= 599 for mock \"%s\"", response.Status, mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if pr := response.Proxy; pr != nil {
+		if response.ResponseBody != nil || response.ResponseFile != nil {
+			errMsg := fmt.Sprintf("response section has proxy and body/file only one can be present for \"%s\"", mock.Name)
+			return invalidConfErr(fp, errMsg)
 		}
 
-		inValidRange := mock.Response.Status >= 100 && mock.Response.Status <= 599
-		// not in valid range
-		if !inValidRange {
-			errMsg := fmt.Sprintf("status code is %v, shoud be 100 <= status <= 599 for mock \"%s\"", mock.Response.Status, mock.Name)
+		if pr.URL == nil {
+			errMsg := fmt.Sprintf("proxy url cannot be nil/\"\" for mock \"%s\"", mock.Name)
 			return invalidConfErr(fp, errMsg)
 		}
 
-		if mock.Response.ResponseBody == nil && mock.Response.ResponseFile == nil {
-			errMsg := fmt.Sprintf("response section missing body/file atleast one should be present for \"%s\"", mock.Name)
+		u, err := parseUpstreamURL(fp, fmt.Sprintf("proxy url for mock \"%s\"", mock.Name), *pr.URL)
+		if err != nil {
+			return err
+		}
+
+		if pr.Status != 0 && (pr.Status < 100 || pr.Status > 599) {
+			errMsg := fmt.Sprintf("proxy status code is %v, shoud be 100 <= status <= 599 for mock \"%s\"", pr.Status, mock.Name)
 			return invalidConfErr(fp, errMsg)
 		}
+		pr.proxy = newMockProxy(pr, u)
+	}
 
-		if mock.Response.ResponseBody != nil {
-			tmplt, err := template.New(mock.Name).Parse(*mock.Response.ResponseBody)
-			if err != nil {
-				errMsg := fmt.Sprintf("error parsing template for mock \"%s\" error:%s", mock.Name, err.Error())
-				return invalidConfErr(fp, errMsg)
-			}
-			mock.Response.Template = tmplt
+	if f := response.Fault; f != nil {
+		if response.Proxy != nil {
+			errMsg := fmt.Sprintf("response section has proxy and fault only one can be present for \"%s\"", mock.Name)
+			return invalidConfErr(fp, errMsg)
 		}
 
-		if mock.Response.ResponseFile != nil {
-			content, err := ioutil.ReadFile(*mock.Response.ResponseFile)
-			if err != nil {
-				errMsg := fmt.Sprintf("error reading content from:%v for mock \"%s\" error:%s", *mock.Response.ResponseFile, mock.Name, err.Error())
-				return invalidConfErr(fp, errMsg)
-			}
-			mock.Response.Content = content
+		if err := validateFault(fp, mock, f); err != nil {
+			return err
 		}
+	}
 
-		// validate delay
-		if mock.Response.Delay != nil {
-			minDelay := mock.Response.Delay.MinMillis
-			maxDelay := mock.Response.Delay.MaxMillis
+	if ws := response.WebSocket; ws != nil {
+		if response.ResponseBody != nil || response.ResponseFile != nil || response.Proxy != nil || response.Fault != nil {
+			errMsg := fmt.Sprintf("response section has websocket and body/file/proxy/fault only websocket can be present for \"%s\"", mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
 
-			if minDelay < 0 || maxDelay < 0 || maxDelay < minDelay {
-				errMsg := fmt.Sprintf("delay min_millis, max_millis >= 0 min_millis <= max_millis and for mock \"%s\" ", mock.Name)
-				errMsg = fmt.Sprintf("%s found min_millis:%v max_millis:%v", errMsg, minDelay, maxDelay)
-				return invalidConfErr(fp, errMsg)
-			}
+		if err := validateWebSocket(fp, mock, ws); err != nil {
+			return err
 		}
+	}
 
-		// mock looks good
-		log.Infof("mock:\"%v\" with path:\"%v\" validates successfully", mock.Name, *mock.Request.Path)
+	if response.ResponseBody == nil && response.ResponseFile == nil && response.Proxy == nil && response.WebSocket == nil {
+		errMsg := fmt.Sprintf("response section missing body/file/proxy/websocket atleast one should be present for \"%s\"", mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if response.ResponseBody != nil {
+		tmplt, err := template.New(mock.Name).Parse(*response.ResponseBody)
+		if err != nil {
+			errMsg := fmt.Sprintf("error parsing template for mock \"%s\" error:%s", mock.Name, err.Error())
+			return invalidConfErr(fp, errMsg)
+		}
+		response.Template = tmplt
+	}
+
+	if response.ResponseFile != nil {
+		content, err := ioutil.ReadFile(*response.ResponseFile)
+		if err != nil {
+			errMsg := fmt.Sprintf("error reading content from:%v for mock \"%s\" error:%s", *response.ResponseFile, mock.Name, err.Error())
+			return invalidConfErr(fp, errMsg)
+		}
+		response.Content = content
+	}
+
+	// a response is served at least once before moving on in a sequence
+	if response.Repeat < 0 {
+		errMsg := fmt.Sprintf("repeat should be >= 1 found %v for mock \"%s\"", response.Repeat, mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+	if response.Repeat == 0 {
+		response.Repeat = 1
+	}
+
+	// validate delay
+	if response.Delay != nil {
+		if err := validateDelay(fp, fmt.Sprintf("mock \"%s\"", mock.Name), response.Delay); err != nil {
+			return err
+		}
 	}
 
-	// all validation passed we are kosher
 	return nil
 }
 
@@ -322,6 +910,12 @@ func validatePath(filePath string, mock *Mock) error {
 		return invalidConfErr(filePath, errMsg)
 	}
 
+	// the admin API owns everything under its prefix
+	if *path == adminPathPrefix || strings.HasPrefix(*path, adminPathPrefix+"/") {
+		errMsg := fmt.Sprintf("request path \"%v\" is reserved for the mockaroo admin API for mock \"%s\"", *path, mock.Name)
+		return invalidConfErr(filePath, errMsg)
+	}
+
 	//split the path
 	parts := strings.Split(*path, "/")
 
@@ -375,6 +969,14 @@ func validatePath(filePath string, mock *Mock) error {
 	return nil
 }
 
+//mockLocation describes where the mock at index i was declared
+func mockLocation(mocks []*Mock, i int) string {
+	if mocks[i].location != "" {
+		return mocks[i].location
+	}
+	return fmt.Sprintf("index %v", i)
+}
+
 func invalidConfErr(filPath, message string) error {
 	return &InvalidConfigFile{path: filPath, message: message}
 }
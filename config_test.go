@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -202,6 +203,32 @@ func TestMockFailsWhenRequestVerbOrPathMissing(t *testing.T) {
 	})
 }
 
+func TestMockFailsWhenQueryVariablesClash(t *testing.T) {
+	sampleConfig := `
+	server {
+		listen_addr = "localhost:5000"
+		mock "clash" {
+			request {
+				path = "/x"
+				verb = "GET"
+				queries = {
+					a = "{v:1\\.5}"
+					b = "{v:x\\+y}"
+				}
+			}
+			response {
+				body = "clash"
+			}
+		}
+	}
+	`
+	_, err := LoadConfigFromBytes([]byte(sampleConfig))
+	if err == nil {
+		t.Fatalf("expecting config load to fail for a variable used twice in queries")
+	}
+	assertInvalidConfigError(t, err)
+}
+
 func TestConfigPathProcessingWorksCorrectly(t *testing.T) {
 	sampleConfig := `
 	server {
@@ -301,6 +328,184 @@ func TestResponseFileConfigLoadsCorrectly(t *testing.T) {
 	})
 }
 
+func TestConfigLoadsFromBytesAndReader(t *testing.T) {
+	sampleConfig := `
+	server {
+		listen_addr = "localhost:5000"
+		mock "hello_world" {
+			request {
+				path = "/hello"
+				verb = "GET"
+			}
+			response {
+				body = "world"
+			}
+		}
+	}
+	`
+	conf, err := LoadConfigFromBytes([]byte(sampleConfig))
+	if err != nil {
+		t.Fatalf("config load from bytes failed with error:%v>\n%s", err.Error(), sampleConfig)
+	}
+
+	if len(conf.ServerConfig.Mocks) != 1 {
+		t.Errorf("did not find the expected mock count:%v found %v", 1, len(conf.ServerConfig.Mocks))
+	}
+
+	conf, err = LoadConfigFromReader(strings.NewReader(sampleConfig))
+	if err != nil {
+		t.Fatalf("config load from reader failed with error:%v>\n%s", err.Error(), sampleConfig)
+	}
+
+	if *conf.ServerConfig.ListenAddr != "localhost:5000" {
+		t.Errorf("did not find the expected ListenAddr:%v found %v", "localhost:5000", *conf.ServerConfig.ListenAddr)
+	}
+
+	_, err = LoadConfigFromBytes([]byte(`server {`))
+	assertInvalidConfigError(t, err)
+
+	_, err = LoadConfigFromReader(nil)
+	assertInvalidConfigError(t, err)
+}
+
+func TestConfigGlobMergesMocksFromAllFiles(t *testing.T) {
+	dir := configDirHarness(t, map[string]string{
+		"00_server.hcl": `
+		server {
+			listen_addr = "localhost:5000"
+			mock "hello" {
+				request {
+					path = "/hello"
+					verb = "GET"
+				}
+				response {
+					body = "world"
+				}
+			}
+		}
+		`,
+		"10_users.hcl": `
+		server {
+			mock "get_user" {
+				request {
+					path = "/user/{userId}"
+					verb = "GET"
+				}
+				response {
+					body = "user"
+				}
+			}
+		}
+		`,
+		"ignored.txt": "not a config file",
+	})
+
+	for _, pattern := range []string{dir, filepath.Join(dir, "*.hcl")} {
+		conf, err := LoadConfigGlob(pattern)
+		if err != nil {
+			t.Fatalf("config load from %v failed with error:%v", pattern, err)
+		}
+
+		if *conf.ServerConfig.ListenAddr != "localhost:5000" {
+			t.Errorf("did not find the expected ListenAddr:%v found %v", "localhost:5000", *conf.ServerConfig.ListenAddr)
+		}
+
+		mocks := conf.ServerConfig.Mocks
+		if len(mocks) != 2 || mocks[0].Name != "hello" || mocks[1].Name != "get_user" {
+			t.Errorf("expected mocks hello and get_user in file order found %v", conf)
+		}
+	}
+
+	_, err := LoadConfigGlob(filepath.Join(dir, "*.nothing"))
+	assertInvalidConfigError(t, err)
+}
+
+func TestConfigGlobDuplicateMockReportsBothFiles(t *testing.T) {
+	dir := configDirHarness(t, map[string]string{
+		"a.hcl": `
+		server {
+			listen_addr = "localhost:5000"
+			mock "hello" {
+				request {
+					path = "/hello"
+					verb = "GET"
+				}
+				response {
+					body = "world"
+				}
+			}
+		}
+		`,
+		"b.hcl": `
+		server {
+
+			mock "hello" {
+				request {
+					path = "/hello"
+					verb = "POST"
+				}
+				response {
+					body = "world"
+				}
+			}
+		}
+		`,
+	})
+
+	_, err := LoadConfigGlob(dir)
+	assertInvalidConfigError(t, err)
+
+	if err == nil || !strings.Contains(err.Error(), "a.hcl:4") || !strings.Contains(err.Error(), "b.hcl:4") {
+		t.Errorf("expected error to point at a.hcl:4 and b.hcl:4 but found:%v", err)
+	}
+}
+
+func TestConfigGlobConflictingServerSettingsFail(t *testing.T) {
+	mockBlock := `
+			mock "%s" {
+				request {
+					path = "/hello"
+					verb = "GET"
+				}
+				response {
+					body = "world"
+				}
+			}
+	`
+	dir := configDirHarness(t, map[string]string{
+		"a.hcl": `server {
+			listen_addr = "localhost:5000"
+			` + fmt.Sprintf(mockBlock, "a") + `
+		}`,
+		"b.hcl": `server {
+			listen_addr = "localhost:5001"
+			` + fmt.Sprintf(mockBlock, "b") + `
+		}`,
+	})
+
+	_, err := LoadConfigGlob(dir)
+	assertInvalidConfigError(t, err)
+
+	if err == nil || !strings.Contains(err.Error(), "listen_addr") {
+		t.Errorf("expected error about listen_addr set twice but found:%v", err)
+	}
+}
+
+func configDirHarness(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "config_dir_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir for testing")
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %v for testing", name)
+		}
+	}
+	return dir
+}
+
 func assertInvalidConfigError(t *testing.T, err error) {
 	if err, ok := err.(*InvalidConfigFile); !ok {
 		t.Errorf("the error is not of valid type expected:*InvalidConfigFile found %T", err)
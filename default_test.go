@@ -0,0 +1,124 @@
+package mockaroo
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultResponse(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(`
+	server {
+		listen_addr = "localhost:5000"
+
+		default_response {
+			status = 418
+			headers = {
+				x-mockaroo = "unmatched"
+			}
+			body = "no mock for {{.Method}}"
+			delay {
+				distribution = "fixed"
+				millis = 100
+			}
+		}
+
+		mock "hello" {
+			request {
+				path = "/hello"
+				verb = "GET"
+			}
+			response {
+				body = "world"
+			}
+		}
+	}
+	`))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	start := time.Now()
+	resp, err := http.Get(ts.URL + "/nope")
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 418 || resp.Header.Get("x-mockaroo") != "unmatched" {
+		t.Errorf("expected default response status 418 with header found:%v %v", resp.StatusCode, resp.Header)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected default response delay of 100ms found:%v", elapsed)
+	}
+
+	// requests that only missed on the verb get the default response too
+	resp, err = http.Post(ts.URL+"/hello", "text/plain", strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 418 {
+		t.Errorf("expected default response for wrong verb found:%v", resp.StatusCode)
+	}
+
+	if body := getBody(t, ts.URL+"/hello"); body != "world" {
+		t.Errorf("expected matched mock to respond with world found:%v", body)
+	}
+
+	logs := ts.Requests(RequestFilter{Unmatched: true})
+	if len(logs) != 2 || logs[0].Status != 418 || len(logs[1].NearMisses) != 1 {
+		t.Errorf("expected unmatched requests with near misses in the journal found:%+v", logs)
+	}
+}
+
+func TestDefaultResponseDefaultsTo404(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(`
+	server {
+		listen_addr = "localhost:5000"
+		default_response {
+			body = "nothing here"
+		}
+		mock "hello" {
+			request {
+				path = "/hello"
+				verb = "GET"
+			}
+			response {
+				body = "world"
+			}
+		}
+	}
+	`))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	resp, err := http.Get(ts.URL + "/nope")
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected default response status 404 found:%v", resp.StatusCode)
+	}
+}
+
+func TestInvalidDefaultResponseConfigs(t *testing.T) {
+	invalid := map[string]string{
+		"with proxy_fallback": "proxy_fallback = \"http://localhost:9999\"\ndefault_response {\nbody = \"a\"\n}",
+		"bad status":          "default_response {\nstatus = 999\nbody = \"a\"\n}",
+		"no body":             "default_response {\n}",
+		"bad template":        "default_response {\nbody = \"{{.Nope\"\n}",
+	}
+
+	for name, server := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\n" + server + "\nmock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n}\n" +
+			"response {\nbody = \"a\"\n}\n}\n}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil {
+			t.Errorf("%v: expected config load to fail", name)
+		}
+	}
+}
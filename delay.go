@@ -0,0 +1,150 @@
+package mockaroo
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	//DelayUniform draws delays uniformly between min_millis and max_millis
+	DelayUniform = "uniform"
+	//DelayNormal draws delays from a normal distribution with mean_millis and stddev_millis
+	DelayNormal = "normal"
+	//DelayLognormal draws delays from a lognormal distribution given by median_millis and p99_millis
+	DelayLognormal = "lognormal"
+	//DelayFixed always delays for millis
+	DelayFixed = "fixed"
+
+	// standard normal quantile at 0.99, the number of sigmas from the
+	// median to the p99 of a lognormal distribution
+	z99 = 2.3263478740408408
+)
+
+var validDelayDistributions = map[string]struct{}{
+	DelayUniform:   {},
+	DelayNormal:    {},
+	DelayLognormal: {},
+	DelayFixed:     {},
+}
+
+//Delay holds a response back for a time drawn from Distribution, uniform
+//between MinMillis and MaxMillis if not set, for the other distributions
+//MinMillis and MaxMillis (if > 0) bound the delays drawn
+type Delay struct {
+	Distribution *string `hcl:"distribution" json:"distribution,omitempty"`
+	MaxMillis    int64   `hcl:"max_millis,optional" json:"max_millis,omitempty"`
+	MinMillis    int64   `hcl:"min_millis,optional" json:"min_millis,omitempty"`
+	Millis       int64   `hcl:"millis,optional" json:"millis,omitempty"`               // fixed
+	MeanMillis   int64   `hcl:"mean_millis,optional" json:"mean_millis,omitempty"`     // normal
+	StdDevMillis int64   `hcl:"stddev_millis,optional" json:"stddev_millis,omitempty"` // normal
+	MedianMillis int64   `hcl:"median_millis,optional" json:"median_millis,omitempty"` // lognormal
+	P99Millis    int64   `hcl:"p99_millis,optional" json:"p99_millis,omitempty"`       // lognormal
+}
+
+func (d *Delay) distribution() string {
+	if d.Distribution == nil {
+		return DelayUniform
+	}
+	return *d.Distribution
+}
+
+//validateDelay checks that d has what its distribution needs, owner names
+//the mock or server the delay belongs to in errors
+func validateDelay(fp, owner string, d *Delay) error {
+	dist := d.distribution()
+	if _, present := validDelayDistributions[dist]; !present {
+		errMsg := fmt.Sprintf("invalid delay distribution \"%v\" for %s distribution can only be (%s|%s|%s|%s)",
+			dist, owner, DelayUniform, DelayNormal, DelayLognormal, DelayFixed)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	minDelay := d.MinMillis
+	maxDelay := d.MaxMillis
+	bounded := dist == DelayUniform || maxDelay > 0
+	if minDelay < 0 || maxDelay < 0 || (bounded && maxDelay < minDelay) {
+		errMsg := fmt.Sprintf("delay min_millis, max_millis >= 0 min_millis <= max_millis and for %s ", owner)
+		errMsg = fmt.Sprintf("%s found min_millis:%v max_millis:%v", errMsg, minDelay, maxDelay)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	switch dist {
+	case DelayFixed:
+		if d.Millis < 0 {
+			errMsg := fmt.Sprintf("fixed delay millis should be >= 0 for %s found:%v", owner, d.Millis)
+			return invalidConfErr(fp, errMsg)
+		}
+	case DelayNormal:
+		if d.MeanMillis < 0 || d.StdDevMillis <= 0 {
+			errMsg := fmt.Sprintf("normal delay needs mean_millis >= 0 and stddev_millis > 0 for %s found mean_millis:%v stddev_millis:%v",
+				owner, d.MeanMillis, d.StdDevMillis)
+			return invalidConfErr(fp, errMsg)
+		}
+	case DelayLognormal:
+		if d.MedianMillis <= 0 || d.P99Millis <= d.MedianMillis {
+			errMsg := fmt.Sprintf("lognormal delay needs 0 < median_millis < p99_millis for %s found median_millis:%v p99_millis:%v",
+				owner, d.MedianMillis, d.P99Millis)
+			return invalidConfErr(fp, errMsg)
+		}
+	}
+	return nil
+}
+
+//sample draws a delay from the distribution of d
+func (d *Delay) sample(r *lockedRand) time.Duration {
+	var millis float64
+	switch d.distribution() {
+	case DelayFixed:
+		return time.Duration(d.Millis) * time.Millisecond
+	case DelayNormal:
+		millis = float64(d.MeanMillis) + r.NormFloat64()*float64(d.StdDevMillis)
+	case DelayLognormal:
+		mu := math.Log(float64(d.MedianMillis))
+		sigma := (math.Log(float64(d.P99Millis)) - mu) / z99
+		millis = math.Exp(mu + sigma*r.NormFloat64())
+	default:
+		millis = float64(d.MinMillis) + r.Float64()*float64(d.MaxMillis-d.MinMillis)
+	}
+
+	if millis < float64(d.MinMillis) {
+		millis = float64(d.MinMillis)
+	}
+	if d.MaxMillis > 0 && millis > float64(d.MaxMillis) {
+		millis = float64(d.MaxMillis)
+	}
+	return time.Duration(millis * float64(time.Millisecond))
+}
+
+//lockedRand is a seeded random source safe for concurrent use, the zero
+//value is seeded with the default seed on first use
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (lr *lockedRand) seed(seed int64) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.r = rand.New(rand.NewSource(seed))
+}
+
+func (lr *lockedRand) rand() *rand.Rand {
+	if lr.r == nil {
+		lr.r = rand.New(rand.NewSource(nicePrime))
+	}
+	return lr.r
+}
+
+func (lr *lockedRand) Float64() float64 {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.rand().Float64()
+}
+
+func (lr *lockedRand) NormFloat64() float64 {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.rand().NormFloat64()
+}
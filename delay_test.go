@@ -0,0 +1,139 @@
+package mockaroo
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleMillis(d *Delay, n int) []float64 {
+	var r lockedRand
+	r.seed(42)
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = float64(d.sample(&r)) / float64(time.Millisecond)
+	}
+	sort.Float64s(out)
+	return out
+}
+
+func TestDelayDistributions(t *testing.T) {
+	uniform := sampleMillis(&Delay{MinMillis: 100, MaxMillis: 200}, 1000)
+	if uniform[0] < 100 || uniform[len(uniform)-1] > 200 {
+		t.Errorf("expected uniform delays within [100, 200] found [%v, %v]", uniform[0], uniform[len(uniform)-1])
+	}
+	// the delay used to always be max_millis
+	if median := uniform[500]; median < 130 || median > 170 {
+		t.Errorf("expected uniform median around 150 found:%v", median)
+	}
+
+	fixed := DelayFixed
+	for _, m := range sampleMillis(&Delay{Distribution: &fixed, Millis: 25}, 10) {
+		if m != 25 {
+			t.Fatalf("expected fixed delay of 25 found:%v", m)
+		}
+	}
+
+	normal := DelayNormal
+	delays := sampleMillis(&Delay{Distribution: &normal, MeanMillis: 10, StdDevMillis: 20, MaxMillis: 50}, 1000)
+	if delays[0] < 0 || delays[len(delays)-1] > 50 {
+		t.Errorf("expected normal delays clamped to [0, 50] found [%v, %v]", delays[0], delays[len(delays)-1])
+	}
+
+	lognormal := DelayLognormal
+	delays = sampleMillis(&Delay{Distribution: &lognormal, MedianMillis: 100, P99Millis: 1000}, 10000)
+	if median := delays[5000]; median < 90 || median > 110 {
+		t.Errorf("expected lognormal median around 100 found:%v", median)
+	}
+	if p99 := delays[9900]; p99 < 800 || p99 > 1200 {
+		t.Errorf("expected lognormal p99 around 1000 found:%v", p99)
+	}
+}
+
+func TestDelaySeedIsReproducible(t *testing.T) {
+	d := &Delay{MinMillis: 0, MaxMillis: 1000}
+	first := sampleMillis(d, 100)
+	second := sampleMillis(d, 100)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same delays for the same seed, sample %v differs", i)
+		}
+	}
+}
+
+func TestServerDefaultDelay(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(`
+	server {
+		listen_addr = "localhost:5000"
+		delay {
+			distribution = "fixed"
+			millis = 200
+		}
+
+		mock "slow" {
+			request {
+				path = "/slow"
+				verb = "GET"
+			}
+			response {
+				body = "slow"
+			}
+		}
+
+		mock "fast" {
+			request {
+				path = "/fast"
+				verb = "GET"
+			}
+			response {
+				body = "fast"
+				delay {
+					distribution = "fixed"
+					millis = 0
+				}
+			}
+		}
+	}
+	`))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	start := time.Now()
+	getBody(t, ts.URL+"/slow")
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expected server delay of 200ms found:%v", elapsed)
+	}
+
+	start = time.Now()
+	getBody(t, ts.URL+"/fast")
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("expected mock delay to override the server delay found:%v", elapsed)
+	}
+}
+
+func TestInvalidDelayConfigs(t *testing.T) {
+	invalid := map[string]string{
+		"unknown distribution": `distribution = "poisson"`,
+		"min above max":        "min_millis = 20\nmax_millis = 10",
+		"negative fixed":       "distribution = \"fixed\"\nmillis = -1",
+		"normal no stddev":     "distribution = \"normal\"\nmean_millis = 10",
+		"lognormal p99 low":    "distribution = \"lognormal\"\nmedian_millis = 100\np99_millis = 50",
+	}
+
+	for name, delay := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\nmock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n}\n" +
+			"response {\nbody = \"a\"\ndelay {\n" + delay + "\n}\n}\n}\n}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil || !strings.Contains(err.Error(), "mock \"m\"") {
+			t.Errorf("%v: expected config load to fail for mock m found:%v", name, err)
+		}
+
+		src = "server {\nlisten_addr = \"localhost:5000\"\ndelay {\n" + delay + "\n}\nmock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n}\n" +
+			"response {\nbody = \"a\"\n}\n}\n}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil || !strings.Contains(err.Error(), "for server") {
+			t.Errorf("%v: expected config load to fail for server found:%v", name, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package mockaroo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//FaultReset aborts the connection with a TCP reset before responding
+	FaultReset = "reset"
+	//FaultEmptyReply closes the connection without writing anything
+	FaultEmptyReply = "empty_reply"
+	//FaultCloseAfter sends the status, headers and the first Bytes of the body then closes
+	FaultCloseAfter = "close_after"
+	//FaultMalformedChunked sends a chunked body with an invalid chunk size
+	FaultMalformedChunked = "malformed_chunked"
+	//FaultThrottle drips the body out at BytesPerSecond
+	FaultThrottle = "throttle"
+
+	// throttled bodies are written out in this many slices a second
+	throttleSlicesPerSecond = 10
+)
+
+var validFaults = map[string]struct{}{
+	FaultReset:            {},
+	FaultEmptyReply:       {},
+	FaultCloseAfter:       {},
+	FaultMalformedChunked: {},
+	FaultThrottle:         {},
+}
+
+//Fault breaks the response of a mock the way real networks and servers do
+type Fault struct {
+	Type           string `hcl:"type" json:"type"`
+	Bytes          *int   `hcl:"bytes" json:"bytes,omitempty"`                       // body bytes sent for close_after
+	BytesPerSecond *int   `hcl:"bytes_per_second" json:"bytes_per_second,omitempty"` // drip rate for throttle
+}
+
+//validateFault checks that the fault of mock has exactly the settings its type needs
+func validateFault(fp string, mock *Mock, f *Fault) error {
+	if _, present := validFaults[f.Type]; !present {
+		errMsg := fmt.Sprintf("invalid fault type \"%v\" for mock \"%s\" type can only be (%s|%s|%s|%s|%s)",
+			f.Type, mock.Name, FaultReset, FaultEmptyReply, FaultCloseAfter, FaultMalformedChunked, FaultThrottle)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if (f.Type == FaultCloseAfter) != (f.Bytes != nil) {
+		errMsg := fmt.Sprintf("fault bytes should be set for and only for %s for mock \"%s\"", FaultCloseAfter, mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+	if f.Bytes != nil && *f.Bytes < 0 {
+		errMsg := fmt.Sprintf("fault bytes should be >= 0 found %v for mock \"%s\"", *f.Bytes, mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if (f.Type == FaultThrottle) != (f.BytesPerSecond != nil) {
+		errMsg := fmt.Sprintf("fault bytes_per_second should be set for and only for %s for mock \"%s\"", FaultThrottle, mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+	if f.BytesPerSecond != nil && *f.BytesPerSecond <= 0 {
+		errMsg := fmt.Sprintf("fault bytes_per_second should be > 0 found %v for mock \"%s\"", *f.BytesPerSecond, mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+	return nil
+}
+
+//serveFault writes the response of mock broken the way its fault says, the
+//response headers are expected to be set already
+func (s *muxServer) serveFault(w http.ResponseWriter, req *http.Request, mock *Mock, response *Response) {
+	f := response.Fault
+	log.Infof("injecting fault:\"%v\" for mock:\"%v\"", f.Type, mock.Name)
+	if rl := requestLogFromContext(req.Context()); rl != nil {
+		rl.Fault = &f.Type
+	}
+
+	switch f.Type {
+	case FaultReset:
+		conn, _ := hijack(w)
+		// a zero linger makes close send a RST instead of a FIN, TLS
+		// connections are just closed
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		conn.Close()
+
+	case FaultEmptyReply:
+		conn, _ := hijack(w)
+		conn.Close()
+
+	case FaultCloseAfter:
+		body := renderBody(mock, response, req)
+		conn, bw := hijack(w)
+		defer conn.Close()
+
+		n := *f.Bytes
+		if n > len(body) {
+			n = len(body)
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		writeRawHead(bw, response.Status, w.Header())
+		bw.Write(body[:n])
+		bw.Flush()
+
+	case FaultMalformedChunked:
+		body := renderBody(mock, response, req)
+		conn, bw := hijack(w)
+		defer conn.Close()
+
+		w.Header().Del("Content-Length")
+		w.Header().Set("Transfer-Encoding", "chunked")
+		writeRawHead(bw, response.Status, w.Header())
+		// chunk sizes are hex, this one is not
+		fmt.Fprintf(bw, "zz\r\n%s\r\n", body)
+		bw.Flush()
+
+	case FaultThrottle:
+		body := renderBody(mock, response, req)
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		w.WriteHeader(response.Status)
+		throttle(w, req, body, *f.BytesPerSecond)
+	}
+}
+
+//hijack takes over the connection of w, connections that cannot be taken
+//over (HTTP/2 or test recorders) are aborted instead
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		log.Warn("connection cannot be hijacked for fault injection aborting the response")
+		panic(http.ErrAbortHandler)
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		log.Warnf("hijacking connection for fault injection failed error:%v aborting the response", err)
+		panic(http.ErrAbortHandler)
+	}
+	return conn, rw
+}
+
+//writeRawHead writes an HTTP/1.1 status line and headers to a hijacked connection
+func writeRawHead(bw *bufio.ReadWriter, status int, header http.Header) {
+	fmt.Fprintf(bw, "HTTP/1.1 %03d %s\r\n", status, http.StatusText(status))
+	header.Write(bw)
+	fmt.Fprint(bw, "\r\n")
+}
+
+//throttle writes body in slices so that about bytesPerSecond go out every
+//second, it stops early if the client goes away
+func throttle(w http.ResponseWriter, req *http.Request, body []byte, bytesPerSecond int) {
+	slice := bytesPerSecond / throttleSlicesPerSecond
+	if slice == 0 {
+		slice = 1
+	}
+	interval := time.Duration(slice) * time.Second / time.Duration(bytesPerSecond)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	flusher, _ := w.(http.Flusher)
+	for len(body) > 0 {
+		n := slice
+		if n > len(body) {
+			n = len(body)
+		}
+		if _, err := w.Write(body[:n]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		body = body[n:]
+		if len(body) == 0 {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+//renderBody generates the full body of response, template failures are
+//logged and the error message becomes the body
+func renderBody(mock *Mock, response *Response, req *http.Request) []byte {
+	if response.Template == nil {
+		return response.Content
+	}
+
+	var buf bytes.Buffer
+	if err := response.Template.Execute(&buf, NewTemplateContext(req)); err != nil {
+		errMsg := fmt.Sprintf("template execution failed for mock \"%v\" error:%v", mock.Name, err.Error())
+		log.Errorf("%s", errMsg)
+		return []byte(errMsg)
+	}
+	return buf.Bytes()
+}
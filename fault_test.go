@@ -0,0 +1,160 @@
+package mockaroo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const faultTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	mock "reset" {
+		request {
+			path = "/reset"
+			verb = "GET"
+		}
+		response {
+			body = "never seen"
+			fault {
+				type = "reset"
+			}
+		}
+	}
+
+	mock "empty" {
+		request {
+			path = "/empty"
+			verb = "GET"
+		}
+		response {
+			body = "never seen"
+			fault {
+				type = "empty_reply"
+			}
+		}
+	}
+
+	mock "truncated" {
+		request {
+			path = "/truncated"
+			verb = "GET"
+		}
+		response {
+			body = "hello world"
+			fault {
+				type = "close_after"
+				bytes = 5
+			}
+		}
+	}
+
+	mock "chunked" {
+		request {
+			path = "/chunked"
+			verb = "GET"
+		}
+		response {
+			body = "hello world"
+			fault {
+				type = "malformed_chunked"
+			}
+		}
+	}
+
+	mock "drip" {
+		request {
+			path = "/drip"
+			verb = "GET"
+		}
+		response {
+			body = "0123456789012345678901234567890123456789"
+			fault {
+				type = "throttle"
+				bytes_per_second = 100
+			}
+		}
+	}
+}
+`
+
+func TestFaultInjection(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(faultTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	// a fresh connection for every request so faults do not leak into the pool
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	for _, path := range []string{"/reset", "/empty"} {
+		if resp, err := client.Get(ts.URL + path); err == nil {
+			resp.Body.Close()
+			t.Errorf("expected request to %v to fail found status:%v", path, resp.StatusCode)
+		}
+	}
+
+	resp, err := client.Get(ts.URL + "/truncated")
+	if err != nil {
+		t.Fatalf("expected headers of truncated response found error:%v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil || string(body) != "hello" {
+		t.Errorf("expected truncated body:hello with a read error found:%q error:%v", body, err)
+	}
+
+	resp, err = client.Get(ts.URL + "/chunked")
+	if err == nil {
+		_, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		t.Errorf("expected malformed chunked body to fail")
+	}
+
+	start := time.Now()
+	resp, err = client.Get(ts.URL + "/drip")
+	if err != nil {
+		t.Fatalf("throttled request failed with error:%v", err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(body) != 40 {
+		t.Errorf("expected throttled body of 40 bytes found:%v", len(body))
+	}
+	// 40 bytes at 100 bytes a second go out in 4 slices 100ms apart
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("expected throttled body to take at least 300ms found:%v", elapsed)
+	}
+
+	for _, name := range []string{"reset", "empty", "truncated", "chunked", "drip"} {
+		logs := ts.Requests(RequestFilter{MockName: name})
+		if len(logs) != 1 || logs[0].Fault == nil {
+			t.Errorf("expected one request with a fault in the journal for mock %v found:%v", name, logs)
+		}
+	}
+}
+
+func TestInvalidFaultConfigs(t *testing.T) {
+	invalid := map[string]string{
+		"unknown type":             `type = "meltdown"`,
+		"close_after no bytes":     `type = "close_after"`,
+		"negative bytes":           `type = "close_after"` + "\n" + `bytes = -1`,
+		"throttle no rate":         `type = "throttle"`,
+		"zero rate":                `type = "throttle"` + "\n" + `bytes_per_second = 0`,
+		"bytes on the wrong fault": `type = "reset"` + "\n" + `bytes = 10`,
+	}
+
+	for name, fault := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\nmock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n}\n" +
+			"response {\nbody = \"a\"\nfault {\n" + fault + "\n}\n}\n}\n}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil || !strings.Contains(err.Error(), "mock \"m\"") {
+			t.Errorf("%v: expected config load to fail for mock m found:%v", name, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package mockaroo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/gorilla/mux"
+)
+
+//FileMatcher matches a file uploaded in a multipart/form-data request under Field
+type FileMatcher struct {
+	Field       string  `hcl:"field,label" json:"field"`
+	Filename    *string `hcl:"filename" json:"filename,omitempty"`         // regexp for the file name
+	ContentType *string `hcl:"content_type" json:"content_type,omitempty"` // regexp for the content type of the part
+}
+
+//UploadedFile describes a file uploaded in a multipart/form-data request
+type UploadedFile struct {
+	Field       string
+	Filename    string
+	ContentType string
+	Size        int64
+}
+
+//validateFormMatchers checks the form and file matchers of mock
+func validateFormMatchers(fp string, mock *Mock) error {
+	for k, v := range mock.Request.Form {
+		if _, err := regexp.Compile(v); err != nil {
+			errMsg := fmt.Sprintf("invalid request form regexp %s key:\"%s\" in mock \"%s\"", v, k, mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+	}
+
+	for _, fm := range mock.Request.Files {
+		if fm.Field == "" {
+			errMsg := fmt.Sprintf("request file field cannot be \"\" in mock \"%s\"", mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		for _, re := range []*string{fm.Filename, fm.ContentType} {
+			if re == nil {
+				continue
+			}
+			if _, err := regexp.Compile(*re); err != nil {
+				errMsg := fmt.Sprintf("invalid request file regexp %s field:\"%s\" in mock \"%s\"", *re, fm.Field, mock.Name)
+				return invalidConfErr(fp, errMsg)
+			}
+		}
+	}
+	return nil
+}
+
+//formMatcher matches requests whose url encoded or multipart form has a value
+//matching the regexp of every field in form and a file for every file matcher,
+//the regexps are expected to be validated
+func formMatcher(form map[string]string, files []*FileMatcher) mux.MatcherFunc {
+	fields := make(map[string]*regexp.Regexp)
+	for k, v := range form {
+		fields[k] = regexp.MustCompile(v)
+	}
+
+	type compiledFile struct {
+		field                 string
+		filename, contentType *regexp.Regexp
+	}
+	var wanted []compiledFile
+	for _, fm := range files {
+		cf := compiledFile{field: fm.Field}
+		if fm.Filename != nil {
+			cf.filename = regexp.MustCompile(*fm.Filename)
+		}
+		if fm.ContentType != nil {
+			cf.contentType = regexp.MustCompile(*fm.ContentType)
+		}
+		wanted = append(wanted, cf)
+	}
+
+	return func(req *http.Request, rm *mux.RouteMatch) bool {
+		values, uploaded := parseFormBody(req)
+
+		for k, re := range fields {
+			if !anyMatch(re, values[k]) {
+				return false
+			}
+		}
+
+		for _, cf := range wanted {
+			found := false
+			for _, f := range uploaded {
+				if f.Field == cf.field &&
+					(cf.filename == nil || cf.filename.MatchString(f.Filename)) &&
+					(cf.contentType == nil || cf.contentType.MatchString(f.ContentType)) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func anyMatch(re *regexp.Regexp, values []string) bool {
+	for _, v := range values {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+//parseFormBody parses the url encoded or multipart form in the body of req
+//without using it up, files uploaded are described but not kept
+func parseFormBody(req *http.Request) (url.Values, []*UploadedFile) {
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, _ := url.ParseQuery(string(requestBody(req)))
+		return values, nil
+
+	case "multipart/form-data":
+		values := make(url.Values)
+		var files []*UploadedFile
+
+		mr := multipart.NewReader(bytes.NewReader(requestBody(req)), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				// io.EOF at the end, anything else is a broken body which
+				// is matched on what could be read
+				break
+			}
+
+			if part.FileName() == "" {
+				value, _ := ioutil.ReadAll(part)
+				values.Add(part.FormName(), string(value))
+				continue
+			}
+
+			size, _ := io.Copy(ioutil.Discard, part)
+			files = append(files, &UploadedFile{
+				Field:       part.FormName(),
+				Filename:    part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+				Size:        size,
+			})
+		}
+		return values, files
+	}
+	return nil, nil
+}
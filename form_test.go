@@ -0,0 +1,156 @@
+package mockaroo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const formTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	mock "login_admin" {
+		request {
+			path = "/login"
+			verb = "POST"
+			form = {
+				user = "^admin$"
+			}
+		}
+		response {
+			body = "welcome admin"
+		}
+	}
+
+	mock "login" {
+		request {
+			path = "/login"
+			verb = "POST"
+			form = {
+				user = ".+"
+				password = ".+"
+			}
+		}
+		response {
+			body = "welcome {{.Form.Get \"user\"}}"
+		}
+	}
+
+	mock "avatar" {
+		request {
+			path = "/upload"
+			verb = "POST"
+			form = {
+				kind = "^avatar$"
+			}
+			file "image" {
+				filename = "\\.png$"
+				content_type = "^image/"
+			}
+		}
+		response {
+			status = 201
+			body = "{{.Form.Get \"kind\"}} {{(.File \"image\").Filename}} {{(.File \"image\").ContentType}} {{(.File \"image\").Size}}"
+		}
+	}
+}
+`
+
+func multipartBody(t *testing.T, fields map[string]string, field, filename, contentType, content string) (*bytes.Buffer, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	if field != "" {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="`+field+`"; filename="`+filename+`"`)
+		h.Set("Content-Type", contentType)
+		pw, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatalf("cannot create multipart file error:%v", err)
+		}
+		pw.Write([]byte(content))
+	}
+	mw.Close()
+	return &buf, mw.FormDataContentType()
+}
+
+func TestFormMatching(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(formTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	s := &muxServer{conf: conf}
+	s.router = s.newRouter(conf)
+
+	serve := func(path, contentType string, body *bytes.Buffer) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		s.router.ServeHTTP(rr, req)
+		b, _ := ioutil.ReadAll(rr.Body)
+		return rr.Code, strings.TrimSpace(string(b))
+	}
+
+	urlEncoded := "application/x-www-form-urlencoded"
+	form := url.Values{"user": {"admin"}}
+	if code, body := serve("/login", urlEncoded, bytes.NewBufferString(form.Encode())); code != http.StatusOK || body != "welcome admin" {
+		t.Errorf("expected admin login found:%v %v", code, body)
+	}
+
+	form = url.Values{"user": {"bob"}, "password": {"secret"}}
+	if code, body := serve("/login", urlEncoded, bytes.NewBufferString(form.Encode())); code != http.StatusOK || body != "welcome bob" {
+		t.Errorf("expected bob login found:%v %v", code, body)
+	}
+
+	form = url.Values{"user": {"bob"}}
+	if code, _ := serve("/login", urlEncoded, bytes.NewBufferString(form.Encode())); code != http.StatusNotFound {
+		t.Errorf("expected login without password to not match found:%v", code)
+	}
+
+	// multipart fields are matched like url encoded ones
+	mb, ct := multipartBody(t, map[string]string{"user": "carol", "password": "x"}, "", "", "", "")
+	if code, body := serve("/login", ct, mb); code != http.StatusOK || body != "welcome carol" {
+		t.Errorf("expected multipart login found:%v %v", code, body)
+	}
+
+	mb, ct = multipartBody(t, map[string]string{"kind": "avatar"}, "image", "me.png", "image/png", "0123456789")
+	if code, body := serve("/upload", ct, mb); code != http.StatusCreated || body != "avatar me.png image/png 10" {
+		t.Errorf("expected upload to match and echo the file found:%v %v", code, body)
+	}
+
+	mb, ct = multipartBody(t, map[string]string{"kind": "avatar"}, "image", "me.gif", "image/gif", "0123456789")
+	if code, _ := serve("/upload", ct, mb); code != http.StatusNotFound {
+		t.Errorf("expected upload with the wrong file name to not match found:%v", code)
+	}
+
+	mb, ct = multipartBody(t, map[string]string{"kind": "avatar"}, "", "", "", "")
+	if code, _ := serve("/upload", ct, mb); code != http.StatusNotFound {
+		t.Errorf("expected upload without a file to not match found:%v", code)
+	}
+}
+
+func TestInvalidFormMatcherConfigs(t *testing.T) {
+	invalid := map[string]string{
+		"bad form regexp":         `form = { a = "(" }`,
+		"bad filename regexp":     "file \"f\" {\nfilename = \"(\"\n}",
+		"bad content type regexp": "file \"f\" {\ncontent_type = \"[\"\n}",
+		"empty file field":        "file \"\" {\n}",
+	}
+
+	for name, matcher := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\nmock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"POST\"\n" + matcher + "\n}\n" +
+			"response {\nbody = \"a\"\n}\n}\n}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil || !strings.Contains(err.Error(), "mock \"m\"") {
+			t.Errorf("%v: expected config load to fail for mock m found:%v", name, err)
+		}
+	}
+}
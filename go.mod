@@ -5,8 +5,12 @@ go 1.14
 require (
 	github.com/brianvoe/gofakeit/v6 v6.2.2
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/hashicorp/hcl/v2 v2.8.2
 	github.com/sirupsen/logrus v1.7.0
-	github.com/stretchr/testify v1.4.0 // indirect
-	gopkg.in/yaml.v2 v2.2.8 // indirect
+	github.com/xeipuuv/gojsonschema v1.2.0
+	github.com/zclconf/go-cty v1.2.0
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
+	google.golang.org/grpc v1.45.0
+	google.golang.org/protobuf v1.28.0
 )
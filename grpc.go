@@ -0,0 +1,466 @@
+package mockaroo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// field names in the JSON of request messages are as in the .proto file
+var grpcJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+//GRPCConf turns on gRPC mocking for the services in compiled descriptor sets,
+//generate them with protoc --include_imports --descriptor_set_out
+type GRPCConf struct {
+	DescriptorSets []string `hcl:"descriptor_sets"`
+	Reflection     bool     `hcl:"reflection,optional"` // serve the gRPC reflection service for grpcurl and friends
+
+	files *protoregistry.Files
+}
+
+//GRPCMock matches calls to a unary gRPC method and answers them with a
+//response written as JSON which is converted to the output message
+type GRPCMock struct {
+	Name     string            `hcl:"name,label"`
+	Service  string            `hcl:"service"`           // fully qualified e.g. acme.users.v1.Users
+	Method   string            `hcl:"method"`            // e.g. GetUser
+	Metadata map[string]string `hcl:"metadata,optional"` // regexps metadata values should match
+	Request  *BodyMatcher      `hcl:"request,block"`     // matched on the request message as JSON
+	Response *GRPCResponse     `hcl:"response,block"`
+
+	method   protoreflect.MethodDescriptor
+	metadata map[string]*regexp.Regexp
+}
+
+//GRPCResponse is what a grpc_mock answers with, a status other than OK is
+//sent as an error without a message
+type GRPCResponse struct {
+	Body     *string           `hcl:"body"`              // JSON of the output message, can be a template
+	Status   *string           `hcl:"status"`            // gRPC code name e.g. NOT_FOUND, OK if not set
+	Message  *string           `hcl:"message"`           // status message of errors
+	Headers  map[string]string `hcl:"headers,optional"`  // sent as header metadata
+	Trailers map[string]string `hcl:"trailers,optional"` // sent as trailer metadata
+	Delay    *Delay            `hcl:"delay,block"`
+
+	code     codes.Code
+	template *template.Template
+}
+
+//validateGRPC loads the descriptor sets of the grpc block and validates the
+//grpc_mock blocks against them, mocks are the HTTP mocks whose names grpc
+//mocks cannot reuse
+func validateGRPC(fp string, sc *ServerConf, mocks []*Mock) error {
+	gc := sc.GRPC
+	if gc == nil {
+		if len(sc.GRPCMocks) > 0 {
+			return invalidConfErr(fp, "grpc_mock needs a grpc block with the descriptor_sets of the services")
+		}
+		return nil
+	}
+
+	files, err := loadDescriptorSets(fp, gc.DescriptorSets)
+	if err != nil {
+		return err
+	}
+	gc.files = files
+
+	names := make(map[string]bool)
+	for i, gm := range sc.GRPCMocks {
+		name := strings.TrimSpace(gm.Name)
+		if name == "" {
+			errMsg := fmt.Sprintf("invalid empty name for grpc_mock block in index %v, please provide a valid name", i)
+			return invalidConfErr(fp, errMsg)
+		}
+		if names[name] || mockIndex(mocks, name) >= 0 {
+			errMsg := fmt.Sprintf("mock with name %v already exists", name)
+			return invalidConfErr(fp, errMsg)
+		}
+		names[name] = true
+
+		if err := validateGRPCMock(fp, files, gm); err != nil {
+			return err
+		}
+		log.Infof("grpc_mock:\"%v\" for method:\"%v\" validates successfully", gm.Name, gm.method.FullName())
+	}
+	return validateGRPCListeners(fp, sc.listeners, sc.GRPCMocks)
+}
+
+//loadDescriptorSets reads the FileDescriptorSets at paths into one registry,
+//files found in more than one set are taken once
+func loadDescriptorSets(fp string, paths []string) (*protoregistry.Files, error) {
+	if len(paths) == 0 {
+		return nil, invalidConfErr(fp, "grpc descriptor_sets cannot be empty")
+	}
+
+	all := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			errMsg := fmt.Sprintf("cannot read grpc descriptor set \"%s\" error:%v", p, err)
+			return nil, invalidConfErr(fp, errMsg)
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(b, set); err != nil {
+			errMsg := fmt.Sprintf("grpc descriptor set \"%s\" is not a FileDescriptorSet error:%v", p, err)
+			return nil, invalidConfErr(fp, errMsg)
+		}
+		for _, f := range set.File {
+			if !seen[f.GetName()] {
+				seen[f.GetName()] = true
+				all.File = append(all.File, f)
+			}
+		}
+	}
+
+	files, err := protodesc.NewFiles(all)
+	if err != nil {
+		errMsg := fmt.Sprintf("invalid grpc descriptor sets, generate them with protoc --include_imports error:%v", err)
+		return nil, invalidConfErr(fp, errMsg)
+	}
+	return files, nil
+}
+
+//validateGRPCMock resolves the method of gm and checks its matchers and response
+func validateGRPCMock(fp string, files *protoregistry.Files, gm *GRPCMock) error {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(gm.Service))
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if err != nil || !ok {
+		errMsg := fmt.Sprintf("service \"%s\" of grpc_mock \"%s\" not found in the descriptor sets", gm.Service, gm.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(gm.Method))
+	if md == nil {
+		errMsg := fmt.Sprintf("method \"%s\" of grpc_mock \"%s\" not found in service \"%s\"", gm.Method, gm.Name, gm.Service)
+		return invalidConfErr(fp, errMsg)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		errMsg := fmt.Sprintf("method \"%s\" of grpc_mock \"%s\" is streaming only unary methods can be mocked", md.FullName(), gm.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+	gm.method = md
+
+	gm.metadata = make(map[string]*regexp.Regexp)
+	for key, expr := range gm.Metadata {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid metadata regexp %s key:\"%s\" in grpc_mock \"%s\"", expr, key, gm.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		// metadata keys are always lower case on the wire
+		gm.metadata[strings.ToLower(key)] = re
+	}
+
+	if gm.Request != nil {
+		if err := validateBodyMatcher(fp, &Mock{Name: gm.Name}, gm.Request); err != nil {
+			return err
+		}
+	}
+
+	r := gm.Response
+	if r == nil {
+		errMsg := fmt.Sprintf("grpc_mock \"%s\" has no response block", gm.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	r.code = codes.OK
+	if r.Status != nil {
+		if err := r.code.UnmarshalJSON([]byte(fmt.Sprintf("%q", *r.Status))); err != nil {
+			errMsg := fmt.Sprintf("invalid status \"%s\" in grpc_mock \"%s\" status should be a gRPC code name like NOT_FOUND", *r.Status, gm.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+	}
+	if r.code != codes.OK && r.Body != nil {
+		errMsg := fmt.Sprintf("grpc_mock \"%s\" with status %s cannot have a body", gm.Name, *r.Status)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	r.template = nil
+	if r.Body != nil {
+		// bodies without actions can be checked against the output message right away
+		if !strings.Contains(*r.Body, "{{") {
+			if err := protojson.Unmarshal([]byte(*r.Body), dynamicpb.NewMessage(md.Output())); err != nil {
+				errMsg := fmt.Sprintf("body of grpc_mock \"%s\" is not a valid %s error:%v", gm.Name, md.Output().FullName(), err)
+				return invalidConfErr(fp, errMsg)
+			}
+		}
+		tmpl, err := template.New(gm.Name).Parse(*r.Body)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid body template in grpc_mock \"%s\" error:%v", gm.Name, err)
+			return invalidConfErr(fp, errMsg)
+		}
+		r.template = tmpl
+	}
+
+	if r.Delay != nil {
+		if err := validateDelay(fp, fmt.Sprintf("grpc_mock \"%s\"", gm.Name), r.Delay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//matches checks the metadata and the JSON of the request message of a call
+//against the matchers of gm
+func (gm *GRPCMock) matches(md metadata.MD, body []byte) bool {
+	for key, re := range gm.metadata {
+		found := false
+		for _, v := range md.Get(key) {
+			if re.MatchString(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return gm.Request == nil || gm.Request.match(body)
+}
+
+//grpcMockIndex is the index of the grpc mock called name, -1 if there is none
+func grpcMockIndex(grpcMocks []*GRPCMock, name string) int {
+	for i, gm := range grpcMocks {
+		if gm.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+//isGRPCRequest checks if req is a gRPC call, these come in over HTTP/2 only
+func isGRPCRequest(req *http.Request) bool {
+	return req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+//newGRPCServer builds a gRPC server for every service in the descriptor sets
+//of conf answered by its grpc mocks, nil if there is no grpc block
+func (s *muxServer) newGRPCServer(conf *Config) *grpc.Server {
+	sc := conf.ServerConfig
+	if sc.GRPC == nil {
+		return nil
+	}
+
+	served := grpcMockListeners(sc.listeners, sc.GRPCMocks)
+	byMethod := make(map[protoreflect.FullName][]*GRPCMock)
+	for _, gm := range sc.GRPCMocks {
+		byMethod[gm.method.FullName()] = append(byMethod[gm.method.FullName()], gm)
+	}
+
+	gs := grpc.NewServer()
+	sc.GRPC.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			sd := services.Get(i)
+			desc := &grpc.ServiceDesc{
+				ServiceName: string(sd.FullName()),
+				HandlerType: (*interface{})(nil),
+				Metadata:    fd.Path(),
+			}
+			methods := sd.Methods()
+			for j := 0; j < methods.Len(); j++ {
+				md := methods.Get(j)
+				if md.IsStreamingClient() || md.IsStreamingServer() {
+					desc.Streams = append(desc.Streams, grpc.StreamDesc{
+						StreamName:    string(md.Name()),
+						Handler:       unmockedStream,
+						ServerStreams: md.IsStreamingServer(),
+						ClientStreams: md.IsStreamingClient(),
+					})
+					continue
+				}
+				desc.Methods = append(desc.Methods, grpc.MethodDesc{
+					MethodName: string(md.Name()),
+					Handler:    s.grpcHandler(md, byMethod[md.FullName()], served, sc.Delay),
+				})
+			}
+			gs.RegisterService(desc, nil)
+		}
+		return true
+	})
+
+	if sc.GRPC.Reflection {
+		rpb.RegisterServerReflectionServer(gs, reflection.NewServer(reflection.ServerOptions{
+			Services:           gs,
+			DescriptorResolver: chainResolver{sc.GRPC.files, protoregistry.GlobalFiles},
+		}))
+	}
+	return gs
+}
+
+//grpcHandler answers calls to the unary method md with the first of mocks
+//that matches and is served on the listener of the call as in served,
+//defaultDelay is used for responses without a delay
+func (s *muxServer) grpcHandler(md protoreflect.MethodDescriptor, mocks []*GRPCMock, served map[string]map[string]bool, defaultDelay *Delay) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (out interface{}, err error) {
+		in := dynamicpb.NewMessage(md.Input())
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+
+		// protojson varies its whitespace on purpose, matchers get it compacted
+		var body bytes.Buffer
+		raw, _ := grpcJSON.Marshal(in)
+		json.Compact(&body, raw)
+
+		incoming, _ := metadata.FromIncomingContext(ctx)
+		rl := grpcRequestLog(ctx, md, incoming, body.String())
+		defer func() {
+			rl.GRPCStatus = status.Code(err).String()
+			s.logRequest(rl)
+		}()
+
+		for _, gm := range mocks {
+			if names, present := served[gm.Name]; present && !onListener(ctx, names) {
+				continue
+			}
+			if !gm.matches(incoming, body.Bytes()) {
+				continue
+			}
+			log.Infof("grpc call matched grpc_mock:\"%v\" with method:\"%v\"", gm.Name, md.FullName())
+			rl.MockName = &gm.Name
+			return s.grpcResponse(ctx, gm, rl, defaultDelay)
+		}
+
+		log.Warnf("grpc call to method:%v did not match any grpc_mock", md.FullName())
+		return nil, status.Errorf(codes.Unimplemented, "no grpc_mock matched the call to %s", md.FullName())
+	}
+}
+
+//grpcResponse delays and builds the response of gm for the call logged in rl
+func (s *muxServer) grpcResponse(ctx context.Context, gm *GRPCMock, rl *RequestLog, defaultDelay *Delay) (interface{}, error) {
+	r := gm.Response
+
+	delay := r.Delay
+	if delay == nil {
+		delay = defaultDelay
+	}
+	if delay != nil {
+		time.Sleep(delay.sample(&s.delays))
+	}
+
+	if len(r.Headers) > 0 {
+		grpc.SetHeader(ctx, metadata.New(r.Headers))
+	}
+	if len(r.Trailers) > 0 {
+		grpc.SetTrailer(ctx, metadata.New(r.Trailers))
+	}
+
+	if r.code != codes.OK {
+		msg := ""
+		if r.Message != nil {
+			msg = *r.Message
+		}
+		return nil, status.Error(r.code, msg)
+	}
+
+	out := dynamicpb.NewMessage(gm.method.Output())
+	if r.template == nil {
+		return out, nil
+	}
+
+	var body bytes.Buffer
+	if err := r.template.Execute(&body, grpcTemplateContext(rl)); err != nil {
+		log.Warnf("error executing body template of grpc_mock:\"%v\" error:%v", gm.Name, err)
+		return nil, status.Errorf(codes.Internal, "error executing body template of grpc_mock %q: %v", gm.Name, err)
+	}
+	if err := protojson.Unmarshal(body.Bytes(), out); err != nil {
+		log.Warnf("body of grpc_mock:\"%v\" is not a valid %v error:%v", gm.Name, gm.method.Output().FullName(), err)
+		return nil, status.Errorf(codes.Internal, "body of grpc_mock %q is not a valid %s: %v", gm.Name, gm.method.Output().FullName(), err)
+	}
+	return out, nil
+}
+
+//unmockedStream answers calls to streaming methods which cannot be mocked
+func unmockedStream(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.Method(stream.Context())
+	return status.Errorf(codes.Unimplemented, "streaming method %s cannot be mocked", method)
+}
+
+//grpcRequestLog is requestLogFromRequest for a gRPC call to md, body is the
+//request message as JSON
+func grpcRequestLog(ctx context.Context, md protoreflect.MethodDescriptor, incoming metadata.MD, body string) *RequestLog {
+	path := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	method := http.MethodPost
+	t := time.Now().UTC()
+	remote := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remote = p.Addr.String()
+	}
+	listener, _ := listenerFromContext(ctx)
+	return &RequestLog{
+		RequestUri:    &path,
+		Timestamp:     &t,
+		Headers:       http.Header(incoming),
+		Method:        &method,
+		ContentLength: int64(len(body)),
+		RemoteAddr:    &remote,
+		Path:          &path,
+		Listener:      listener,
+		Body:          body,
+		Status:        http.StatusOK,
+	}
+}
+
+//grpcTemplateContext is the template context for the call logged in rl, the
+//request message is in JsonBody and the metadata in Headers
+func grpcTemplateContext(rl *RequestLog) *TemplateContext {
+	var jsonBody map[string]interface{}
+	json.Unmarshal([]byte(rl.Body), &jsonBody)
+	protocol := "HTTP/2.0"
+	return &TemplateContext{
+		Method:     rl.Method,
+		Protocol:   &protocol,
+		RemoteAddr: rl.RemoteAddr,
+		Headers:    rl.Headers,
+		JsonBody:   jsonBody,
+		PathVars:   map[string]string{},
+		Fake:       stableFake,
+		uuid:       make([]byte, 16), // 16 bytes for UUID
+	}
+}
+
+//chainResolver looks up descriptors in the descriptor sets first and then in
+//the files compiled into mockaroo, which has the reflection service itself
+type chainResolver []*protoregistry.Files
+
+func (cr chainResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	for _, files := range cr {
+		if fd, err := files.FindFileByPath(path); err == nil {
+			return fd, nil
+		}
+	}
+	return nil, protoregistry.NotFound
+}
+
+func (cr chainResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	for _, files := range cr {
+		if d, err := files.FindDescriptorByName(name); err == nil {
+			return d, nil
+		}
+	}
+	return nil, protoregistry.NotFound
+}
@@ -0,0 +1,359 @@
+package mockaroo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const grpcTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	grpc {
+		descriptor_sets = ["%s"]
+		reflection      = true
+	}
+
+	grpc_mock "vip" {
+		service  = "test.users.v1.Users"
+		method   = "GetUser"
+		metadata = {
+			"X-Tier" = "^gold$"
+		}
+		response {
+			body = "{\"user_id\": \"{{.JsonBody.user_id}}\", \"name\": \"VIP\"}"
+		}
+	}
+
+	grpc_mock "alice" {
+		service = "test.users.v1.Users"
+		method  = "GetUser"
+		request {
+			json_path = {
+				"user_id" = "^alice$"
+			}
+		}
+		response {
+			body     = "{\"user_id\": \"alice\", \"name\": \"Alice\", \"age\": 30}"
+			headers  = { "x-mock" = "alice" }
+			trailers = { "x-served-by" = "mockaroo" }
+		}
+	}
+
+	grpc_mock "missing" {
+		service = "test.users.v1.Users"
+		method  = "GetUser"
+		response {
+			status  = "NOT_FOUND"
+			message = "no such user"
+		}
+	}
+}
+`
+
+//writeTestDescriptorSet writes a FileDescriptorSet for a users service with
+//a unary and a server streaming method and returns its path
+func writeTestDescriptorSet(t *testing.T) string {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+	}
+	str, i32 := descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_INT32
+
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/users.proto"),
+		Package: proto.String("test.users.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("GetUserRequest"), Field: []*descriptorpb.FieldDescriptorProto{field("user_id", 1, str)}},
+			{Name: proto.String("User"), Field: []*descriptorpb.FieldDescriptorProto{field("user_id", 1, str), field("name", 2, str), field("age", 3, i32)}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Users"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("GetUser"), InputType: proto.String(".test.users.v1.GetUserRequest"), OutputType: proto.String(".test.users.v1.User")},
+				{Name: proto.String("Watch"), InputType: proto.String(".test.users.v1.GetUserRequest"), OutputType: proto.String(".test.users.v1.User"), ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fd}})
+	if err != nil {
+		t.Fatalf("cannot marshal descriptor set error:%v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "grpc_test")
+	if err != nil {
+		t.Fatalf("cannot create temp dir error:%v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "users.pb")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatalf("cannot write descriptor set error:%v", err)
+	}
+	return path
+}
+
+//startGRPCTestServer starts a test server with the grpc test config and
+//returns it along with a client connection and the users service descriptor
+func startGRPCTestServer(t *testing.T) (*TestServer, *grpc.ClientConn, protoreflect.ServiceDescriptor) {
+	path := writeTestDescriptorSet(t)
+	conf, err := LoadConfigFromBytes([]byte(fmt.Sprintf(grpcTestConfig, path)))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	conn, err := grpc.Dial(strings.TrimPrefix(ts.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("cannot dial test server error:%v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	d, _ := conf.ServerConfig.GRPC.files.FindDescriptorByName("test.users.v1.Users")
+	return ts, conn, d.(protoreflect.ServiceDescriptor)
+}
+
+func TestGRPCMocks(t *testing.T) {
+	ts, conn, sd := startGRPCTestServer(t)
+	md := sd.Methods().ByName("GetUser")
+
+	call := func(ctx context.Context, userID string, opts ...grpc.CallOption) (*dynamicpb.Message, error) {
+		in := dynamicpb.NewMessage(md.Input())
+		in.Set(md.Input().Fields().ByName("user_id"), protoreflect.ValueOfString(userID))
+		out := dynamicpb.NewMessage(md.Output())
+		err := conn.Invoke(ctx, "/test.users.v1.Users/GetUser", in, out, opts...)
+		return out, err
+	}
+	get := func(m *dynamicpb.Message, name string) interface{} {
+		return m.Get(md.Output().Fields().ByName(protoreflect.Name(name))).Interface()
+	}
+
+	var header, trailer metadata.MD
+	out, err := call(context.Background(), "alice", grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		t.Fatalf("call for alice failed with error:%v", err)
+	}
+	if get(out, "name") != "Alice" || get(out, "age") != int32(30) {
+		t.Errorf("expected Alice aged 30 found:%v", out)
+	}
+	if v := header.Get("x-mock"); len(v) != 1 || v[0] != "alice" {
+		t.Errorf("expected header x-mock:alice found:%v", header)
+	}
+	if v := trailer.Get("x-served-by"); len(v) != 1 || v[0] != "mockaroo" {
+		t.Errorf("expected trailer x-served-by:mockaroo found:%v", trailer)
+	}
+
+	// metadata matches before the request message and the body is a template
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tier", "gold")
+	out, err = call(ctx, "bob")
+	if err != nil {
+		t.Fatalf("call for vip failed with error:%v", err)
+	}
+	if get(out, "name") != "VIP" || get(out, "user_id") != "bob" {
+		t.Errorf("expected VIP bob found:%v", out)
+	}
+
+	_, err = call(context.Background(), "carol")
+	if st := status.Convert(err); st.Code() != codes.NotFound || st.Message() != "no such user" {
+		t.Errorf("expected NOT_FOUND no such user found:%v", err)
+	}
+
+	// streaming methods are served but cannot be mocked
+	err = conn.Invoke(context.Background(), "/test.users.v1.Users/Watch", dynamicpb.NewMessage(md.Input()), dynamicpb.NewMessage(md.Output()))
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented for streaming method found:%v", err)
+	}
+
+	reqs := ts.Requests(RequestFilter{MockName: "alice"})
+	if len(reqs) != 1 || reqs[0].Body != `{"user_id":"alice"}` || reqs[0].GRPCStatus != "OK" {
+		t.Errorf("expected the journal to record the call for alice found:%+v", reqs)
+	}
+	reqs = ts.Requests(RequestFilter{MockName: "missing"})
+	if len(reqs) != 1 || reqs[0].GRPCStatus != "NotFound" {
+		t.Errorf("expected the journal to record the NOT_FOUND call found:%+v", reqs)
+	}
+}
+
+const grpcListenerTestConfig = `
+server {
+	grpc {
+		descriptor_sets = ["%s"]
+	}
+
+	listener "users" {
+		listen_addr = "localhost:5000"
+		mocks       = ["alice"]
+	}
+
+	listener "all" {
+		listen_addr = "localhost:5001"
+	}
+
+	grpc_mock "alice" {
+		service = "test.users.v1.Users"
+		method  = "GetUser"
+		request {
+			json_path = {
+				"user_id" = "^alice$"
+			}
+		}
+		response {
+			body = "{\"name\": \"Alice\"}"
+		}
+	}
+
+	grpc_mock "anyone" {
+		service = "test.users.v1.Users"
+		method  = "GetUser"
+		response {
+			body = "{\"name\": \"Anyone\"}"
+		}
+	}
+}
+`
+
+func TestGRPCListenerMocks(t *testing.T) {
+	path := writeTestDescriptorSet(t)
+	conf, err := LoadConfigFromBytes([]byte(fmt.Sprintf(grpcListenerTestConfig, path)))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+	d, _ := conf.ServerConfig.GRPC.files.FindDescriptorByName("test.users.v1.Users")
+	md := d.(protoreflect.ServiceDescriptor).Methods().ByName("GetUser")
+
+	call := func(listener, userID string) (string, error) {
+		conn, err := grpc.Dial(strings.TrimPrefix(ts.URLs[listener], "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("cannot dial listener %v error:%v", listener, err)
+		}
+		defer conn.Close()
+		in := dynamicpb.NewMessage(md.Input())
+		in.Set(md.Input().Fields().ByName("user_id"), protoreflect.ValueOfString(userID))
+		out := dynamicpb.NewMessage(md.Output())
+		err = conn.Invoke(context.Background(), "/test.users.v1.Users/GetUser", in, out)
+		return out.Get(md.Output().Fields().ByName("name")).String(), err
+	}
+
+	if name, err := call("users", "alice"); err != nil || name != "Alice" {
+		t.Errorf("expected Alice on listener users found:%q %v", name, err)
+	}
+	// anyone is not in the mocks of listener users
+	if _, err := call("users", "bob"); status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented for bob on listener users found:%v", err)
+	}
+	if name, err := call("all", "bob"); err != nil || name != "Anyone" {
+		t.Errorf("expected Anyone on listener all found:%q %v", name, err)
+	}
+
+	reqs := ts.Requests(RequestFilter{MockName: "anyone"})
+	if len(reqs) != 1 || reqs[0].Listener != "all" {
+		t.Errorf("expected the journal to record 1 call to anyone on listener all found:%+v", reqs)
+	}
+}
+
+func TestGRPCReflection(t *testing.T) {
+	_, conn, _ := startGRPCTestServer(t)
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("cannot open reflection stream error:%v", err)
+	}
+	defer stream.CloseSend()
+
+	stream.Send(&rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_ListServices{}})
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("list services failed with error:%v", err)
+	}
+	services := make(map[string]bool)
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		services[s.Name] = true
+	}
+	if !services["test.users.v1.Users"] {
+		t.Errorf("expected reflection to list test.users.v1.Users found:%v", services)
+	}
+
+	stream.Send(&rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "test.users.v1.Users"}})
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("file containing symbol failed with error:%v", err)
+	}
+	files := resp.GetFileDescriptorResponse().GetFileDescriptorProto()
+	if len(files) == 0 {
+		t.Fatalf("expected the file of the users service found:%v", resp)
+	}
+	fd := &descriptorpb.FileDescriptorProto{}
+	if err := proto.Unmarshal(files[0], fd); err != nil || fd.GetName() != "test/users.proto" {
+		t.Errorf("expected test/users.proto found:%v error:%v", fd.GetName(), err)
+	}
+	if _, err := protodesc.NewFile(fd, nil); err != nil {
+		t.Errorf("expected a valid file descriptor error:%v", err)
+	}
+}
+
+func TestInvalidGRPCConfigs(t *testing.T) {
+	path := writeTestDescriptorSet(t)
+	grpcBlock := fmt.Sprintf("grpc {\ndescriptor_sets = [\"%s\"]\n}\n", path)
+	mock := "grpc_mock \"m\" {\nservice = \"%s\"\nmethod = \"%s\"\n%s\n}\n"
+
+	invalid := map[string]string{
+		"no grpc block":      fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {}"),
+		"no descriptor sets": "grpc {\ndescriptor_sets = []\n}\n" + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {}"),
+		"missing set":        "grpc {\ndescriptor_sets = [\"" + path + ".nope\"]\n}\n" + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {}"),
+		"unknown service":    grpcBlock + fmt.Sprintf(mock, "test.users.v1.Nope", "GetUser", "response {}"),
+		"unknown method":     grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "Nope", "response {}"),
+		"streaming method":   grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "Watch", "response {}"),
+		"no response":        grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", ""),
+		"bad status":         grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {\nstatus = \"NOPE\"\n}"),
+		"error with body":    grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {\nstatus = \"INTERNAL\"\nbody = \"{}\"\n}"),
+		"unknown field":      grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {\nbody = \"{\\\"nope\\\": 1}\"\n}"),
+		"bad metadata":       grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "metadata = { \"a\" = \"(\" }\nresponse {}"),
+		"bad request regexp": grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "request {\nmatches = \"(\"\n}\nresponse {}"),
+		"http1 server":       "protocol = \"http1\"\n" + grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {}"),
+		"http1 listener":     "listener \"web\" {\nlisten_addr = \"localhost:5001\"\nprotocol = \"http1\"\nmocks = [\"m\"]\n}\n" + grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {}"),
+		"unknown mock":       "listener \"web\" {\nlisten_addr = \"localhost:5001\"\nmocks = [\"nope\"]\n}\n" + grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {}"),
+	}
+
+	for name, body := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\n" + body + "}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil {
+			t.Errorf("%v: expected config load to fail", name)
+		}
+	}
+
+	src := "server {\nlisten_addr = \"localhost:5000\"\n" + grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {\nbody = \"{\\\"age\\\": {{.JsonBody.age}}}\"\n}") + "}\n"
+	if _, err := LoadConfigFromBytes([]byte(src)); err != nil {
+		t.Errorf("expected config with only a grpc mock to load found:%v", err)
+	}
+
+	// http1 listeners are fine as long as they serve no grpc mocks
+	web := "listener \"web\" {\nlisten_addr = \"localhost:5001\"\nprotocol = \"http1\"\nmocks = [\"h\"]\n}\n"
+	httpMock := "mock \"h\" {\nrequest {\npath = \"/h\"\nverb = \"GET\"\n}\nresponse {\nbody = \"h\"\n}\n}\n"
+	src = "server {\nlisten_addr = \"localhost:5000\"\n" + web + httpMock + grpcBlock + fmt.Sprintf(mock, "test.users.v1.Users", "GetUser", "response {}") + "}\n"
+	if _, err := LoadConfigFromBytes([]byte(src)); err != nil {
+		t.Errorf("expected config with a http1 listener serving no grpc mocks to load found:%v", err)
+	}
+}
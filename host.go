@@ -0,0 +1,94 @@
+package mockaroo
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var validSchemes = map[string]struct{}{
+	"http":  {},
+	"https": {},
+}
+
+//hostTemplate turns a host with "*" wildcards into a gorilla host template,
+//every "*" label matches a single label e.g. "*.example.com" matches
+//"api.example.com" but not "example.com", labels like "{name:regexp}" are
+//passed as they are and captured as path variables
+func hostTemplate(host string) string {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if label == "*" {
+			labels[i] = fmt.Sprintf("{host%d:[^.]+}", i)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+//validateHostMatchers checks the host, scheme and client CIDR matchers of
+//mock and fills in the parsed client networks
+func validateHostMatchers(fp string, mock *Mock) error {
+	req := mock.Request
+
+	if req.Host != nil {
+		if strings.TrimSpace(*req.Host) == "" {
+			errMsg := fmt.Sprintf("request host cannot be \"\" in mock \"%s\"", mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		if err := new(mux.Route).Host(hostTemplate(*req.Host)).GetError(); err != nil {
+			errMsg := fmt.Sprintf("invalid request host \"%s\" in mock \"%s\" error:%v", *req.Host, mock.Name, err)
+			return invalidConfErr(fp, errMsg)
+		}
+	}
+
+	if req.Scheme != nil {
+		scheme := strings.ToLower(*req.Scheme)
+		if _, present := validSchemes[scheme]; !present {
+			errMsg := fmt.Sprintf("invalid request scheme \"%s\" in mock \"%s\" scheme can only be (http|https)", *req.Scheme, mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		req.Scheme = &scheme
+	}
+
+	req.clientNets = nil
+	for _, cidr := range req.ClientCIDRs {
+		// a plain IP matches only itself
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid request client_cidrs entry \"%s\" in mock \"%s\" error:%v", cidr, mock.Name, err)
+			return invalidConfErr(fp, errMsg)
+		}
+		req.clientNets = append(req.clientNets, ipNet)
+	}
+	return nil
+}
+
+//clientCIDRMatcher matches requests coming from an address in any of nets
+func clientCIDRMatcher(nets []*net.IPNet) mux.MatcherFunc {
+	return func(req *http.Request, rm *mux.RouteMatch) bool {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
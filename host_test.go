@@ -0,0 +1,124 @@
+package mockaroo
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const hostTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	mock "stripe" {
+		request {
+			path = "/v1/charges"
+			verb = "GET"
+			host = "api.stripe.com"
+			scheme = "https"
+		}
+		response {
+			body = "stripe charges"
+		}
+	}
+
+	mock "example_login" {
+		request {
+			path = "/v1/charges"
+			verb = "GET"
+			host = "*.example.com"
+		}
+		response {
+			body = "example {{.PathVariable \"host0\"}}"
+		}
+	}
+
+	mock "tenant" {
+		request {
+			path = "/v1/charges"
+			verb = "GET"
+			host = "{tenant:[a-z]+}.tenants.local"
+		}
+		response {
+			body = "tenant {{.PathVariable \"tenant\"}}"
+		}
+	}
+
+	mock "internal" {
+		request {
+			path = "/v1/charges"
+			verb = "GET"
+			client_cidrs = ["10.0.0.0/8", "192.168.1.7"]
+		}
+		response {
+			body = "internal"
+		}
+	}
+}
+`
+
+func TestHostSchemeAndClientMatching(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(hostTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	s := &muxServer{conf: conf}
+	s.router = s.newRouter(conf)
+
+	tests := []struct {
+		host       string
+		tls        bool
+		remoteAddr string
+		expected   string
+	}{
+		{"api.stripe.com", true, "127.0.0.1:1234", "stripe charges"},
+		// the port is ignored when the host has none
+		{"api.stripe.com:8443", true, "127.0.0.1:1234", "stripe charges"},
+		{"api.stripe.com", false, "127.0.0.1:1234", ""},
+		{"login.example.com", false, "127.0.0.1:1234", "example login"},
+		{"example.com", false, "127.0.0.1:1234", ""},
+		{"acme.tenants.local", false, "127.0.0.1:1234", "tenant acme"},
+		{"localhost", false, "10.1.2.3:1234", "internal"},
+		{"localhost", false, "192.168.1.7:1234", "internal"},
+		{"localhost", false, "192.168.1.8:1234", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/charges", nil)
+		req.Host = test.host
+		req.RemoteAddr = test.remoteAddr
+		if test.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		rr := httptest.NewRecorder()
+		s.router.ServeHTTP(rr, req)
+
+		body := ""
+		if rr.Code == http.StatusOK {
+			body = strings.TrimSpace(rr.Body.String())
+		}
+		if body != test.expected {
+			t.Errorf("host:%v tls:%v remote:%v expected body:%q found:%v %q", test.host, test.tls, test.remoteAddr, test.expected, rr.Code, body)
+		}
+	}
+}
+
+func TestInvalidHostMatcherConfigs(t *testing.T) {
+	invalid := map[string]string{
+		"empty host":   `host = ""`,
+		"bad template": `host = "{sub.example.com"`,
+		"bad scheme":   `scheme = "ftp"`,
+		"bad cidr":     `client_cidrs = ["10.0.0.0/33"]`,
+		"not an ip":    `client_cidrs = ["localhost"]`,
+	}
+
+	for name, matcher := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\nmock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n" + matcher + "\n}\n" +
+			"response {\nbody = \"a\"\n}\n}\n}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil || !strings.Contains(err.Error(), "mock \"m\"") {
+			t.Errorf("%v: expected config load to fail for mock m found:%v", name, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package mockaroo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// number of requests kept in the journal if not configured
+	defaultJournalSize = 1000
+)
+
+type contextKey int
+
+const (
+	// context key under which the RequestLog of the request being handled is kept
+	requestLogKey contextKey = iota
+
+	// context key under which record mode keeps the request as it came in
+	recordRequestKey
+
+	// context key under which the name of the listener a request came in on is kept
+	listenerKey
+)
+
+//RequestFilter selects requests from the journal, zero valued fields match
+//every request
+type RequestFilter struct {
+	//MockName matches requests handled by the mock with this name
+	MockName string
+
+	//Method matches the HTTP method exactly
+	Method string
+
+	//Path matches the URL path exactly
+	Path string
+
+	//BodyContains matches requests whose body contains this string
+	BodyContains string
+
+	//Unmatched selects only requests which did not match any mock
+	Unmatched bool
+}
+
+func (f *RequestFilter) matches(rl *RequestLog) bool {
+	switch {
+	case f.Unmatched && rl.MockName != nil:
+		return false
+	case f.MockName != "" && (rl.MockName == nil || *rl.MockName != f.MockName):
+		return false
+	case f.Method != "" && *rl.Method != f.Method:
+		return false
+	case f.Path != "" && *rl.Path != f.Path:
+		return false
+	case f.BodyContains != "" && !strings.Contains(rl.Body, f.BodyContains):
+		return false
+	}
+	return true
+}
+
+//journal is a bounded in memory record of the most recent requests
+type journal struct {
+	mu      sync.Mutex
+	size    int
+	entries []*RequestLog
+}
+
+func newJournal(size int) *journal {
+	return &journal{size: size}
+}
+
+//add records rl dropping the oldest request if the journal is full, a nil
+//journal records nothing
+func (j *journal) add(rl *RequestLog) {
+	if j == nil || j.size <= 0 {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = append(j.entries, rl)
+	if len(j.entries) > j.size {
+		j.entries = j.entries[len(j.entries)-j.size:]
+	}
+}
+
+func (j *journal) find(filter RequestFilter) []*RequestLog {
+	found := []*RequestLog{}
+	if j == nil {
+		return found
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, rl := range j.entries {
+		if filter.matches(rl) {
+			found = append(found, rl)
+		}
+	}
+	return found
+}
+
+func (j *journal) reset() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = nil
+}
+
+func requestLogFromContext(ctx context.Context) *RequestLog {
+	rl, _ := ctx.Value(requestLogKey).(*RequestLog)
+	return rl
+}
+
+func (s *muxServer) Requests(filter RequestFilter) []*RequestLog {
+	return s.journal.find(filter)
+}
+
+func (s *muxServer) Verify(mockName string, count int) error {
+	found := len(s.journal.find(RequestFilter{MockName: mockName}))
+	if found != count {
+		return fmt.Errorf("expected mock \"%v\" to be called %v times but was called %v times", mockName, count, found)
+	}
+	return nil
+}
+
+func (s *muxServer) ResetRequests() {
+	s.journal.reset()
+}
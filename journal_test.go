@@ -0,0 +1,154 @@
+package mockaroo
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const journalTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+	journal_size = 3
+	mock "create_user" {
+		request {
+			path = "/users"
+			verb = "POST"
+		}
+		response {
+			status = 201
+			body = "created"
+		}
+	}
+}
+`
+
+func TestJournalRecordsAndVerifiesRequests(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(journalTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	postBody(t, ts.URL+"/users", `{"name": "bob"}`)
+	postBody(t, ts.URL+"/users", `{"name": "alice"}`)
+	postBody(t, ts.URL+"/nothing", `{}`)
+
+	if err := ts.Verify("create_user", 2); err != nil {
+		t.Errorf("expected verify to pass but found:%v", err)
+	}
+
+	if err := ts.Verify("create_user", 1); err == nil {
+		t.Errorf("expected verify with wrong count to fail")
+	}
+
+	bobs := ts.Requests(RequestFilter{MockName: "create_user", BodyContains: "bob"})
+	if len(bobs) != 1 {
+		t.Fatalf("expected 1 request with bob in body found:%v", len(bobs))
+	}
+
+	if bobs[0].Status != http.StatusCreated || bobs[0].Body != `{"name": "bob"}` || *bobs[0].Method != "POST" {
+		t.Errorf("unexpected journal entry status:%v body:%v method:%v", bobs[0].Status, bobs[0].Body, *bobs[0].Method)
+	}
+
+	unmatched := ts.Requests(RequestFilter{Unmatched: true})
+	if len(unmatched) != 1 || *unmatched[0].Path != "/nothing" || unmatched[0].Status != http.StatusNotFound {
+		t.Errorf("expected the 404 for /nothing to be journaled as unmatched found:%v", unmatched)
+	}
+
+	// the journal is bounded to 3 entries so the oldest one is dropped
+	postBody(t, ts.URL+"/users", `{"name": "carol"}`)
+	if all := ts.Requests(RequestFilter{}); len(all) != 3 || all[0].Body != `{"name": "alice"}` {
+		t.Errorf("expected journal to keep the latest 3 requests found:%v", len(all))
+	}
+
+	ts.ResetRequests()
+	if err := ts.Verify("create_user", 0); err != nil {
+		t.Errorf("expected verify after reset to pass but found:%v", err)
+	}
+}
+
+func TestJournalAdminEndpoints(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(journalTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	postBody(t, ts.URL+"/users", `{"name": "bob"}`)
+	postBody(t, ts.URL+"/users", `{"name": "alice"}`)
+
+	resp, err := http.Get(ts.URL + adminRequestCountPath + "?mock=create_user&body_contains=alice")
+	if err != nil {
+		t.Fatalf("count requests failed with error:%v", err)
+	}
+	var count map[string]int
+	json.NewDecoder(resp.Body).Decode(&count)
+	resp.Body.Close()
+	if count["count"] != 1 {
+		t.Errorf("expected count 1 found:%v", count)
+	}
+
+	resp, err = http.Get(ts.URL + adminRequestsPath + "?method=POST")
+	if err != nil {
+		t.Fatalf("list requests failed with error:%v", err)
+	}
+	var requests []*RequestLog
+	json.NewDecoder(resp.Body).Decode(&requests)
+	resp.Body.Close()
+	if len(requests) != 2 || *requests[0].MockName != "create_user" {
+		t.Errorf("expected 2 journaled requests for create_user found:%v", requests)
+	}
+
+	if code := adminCall(t, http.MethodDelete, ts.URL+adminRequestsPath, ""); code != http.StatusNoContent {
+		t.Errorf("expected reset to return 204 found:%v", code)
+	}
+
+	// admin calls are never journaled
+	if all := ts.Requests(RequestFilter{}); len(all) != 0 {
+		t.Errorf("expected empty journal after reset found:%v", len(all))
+	}
+}
+
+func postBody(t *testing.T, url, body string) {
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("request to %v failed with error:%v", url, err)
+	}
+	resp.Body.Close()
+}
+
+func TestRequestFilterMatching(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "/a/b?x=y", strings.NewReader(""))
+	rl := requestLogFromRequest(req)
+	name := "mock_a"
+	rl.MockName = &name
+	rl.Body = "hello world"
+
+	matching := []RequestFilter{
+		{},
+		{MockName: "mock_a"},
+		{Method: "PUT", Path: "/a/b"},
+		{BodyContains: "world"},
+	}
+	for _, f := range matching {
+		if !f.matches(rl) {
+			t.Errorf("expected filter %+v to match", f)
+		}
+	}
+
+	notMatching := []RequestFilter{
+		{MockName: "mock_b"},
+		{Method: "GET"},
+		{Path: "/a"},
+		{BodyContains: "bye"},
+		{Unmatched: true},
+	}
+	for _, f := range notMatching {
+		if f.matches(rl) {
+			t.Errorf("expected filter %+v not to match", f)
+		}
+	}
+}
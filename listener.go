@@ -0,0 +1,238 @@
+package mockaroo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// name of the listener for the listen_addr at the top of the server block
+	defaultListenerName = "default"
+)
+
+var listenAddrRegex = regexp.MustCompile(`(?P<host>.+):(?P<port>\d+)`)
+
+//Listener is an address mockaroo serves mocks on, a server can have several
+//listeners each with its own TLS settings and optionally its own mocks
+type Listener struct {
+	Name             string   `hcl:"name,label"`
+	ListenAddr       *string  `hcl:"listen_addr"`
+	SnakeOilCertPath *string  `hcl:"snake_oil_cert"`
+	SnakeOilKeyPath  *string  `hcl:"snake_oil_key"`
+	TLS              *TLSConf `hcl:"tls,block"`
+	Protocol         *string  `hcl:"protocol"`       // auto, http1 or http2
+	Mocks            []string `hcl:"mocks,optional"` // names of the mocks served, all mocks if empty
+	Mode             ServerMode
+}
+
+//validateListeners validates the listener blocks along with the listen_addr
+//at the top of the server block which is served as the "default" listener,
+//the mocks listeners serve are checked once the mocks are validated
+func validateListeners(fp string, sc *ServerConf) error {
+	if len(sc.Listeners) == 0 && (sc.ListenAddr == nil || *sc.ListenAddr == "") {
+		errMsg := fmt.Sprintf("%s field in file null or empty, set it or configure listener blocks", listenAddrField)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	sc.listeners = nil
+	sc.Mode = HTTP
+	if sc.ListenAddr == nil && (sc.TLS != nil || sc.Protocol != nil) {
+		return invalidConfErr(fp, "tls and protocol of the server apply to listen_addr which is not set, move them into a listener block")
+	}
+	if sc.ListenAddr != nil {
+		if err := validateListenAddr(fp, *sc.ListenAddr, ""); err != nil {
+			return err
+		}
+
+		// if key && cert are present then we can start in HTTPS mode
+		log.Info("assuming default mode HTTP")
+		if sc.SnakeOilCertPath != nil && sc.SnakeOilKeyPath != nil {
+			sc.Mode = HTTPS
+			log.Info("snake oil cert && key present will start in HTTPS mode")
+		}
+		if sc.TLS != nil && sc.TLS.Auto {
+			sc.Mode = HTTPS
+			log.Info("tls auto set will start in HTTPS mode with a generated certificate")
+		}
+		sc.listeners = append(sc.listeners, &Listener{
+			Name:             defaultListenerName,
+			ListenAddr:       sc.ListenAddr,
+			SnakeOilCertPath: sc.SnakeOilCertPath,
+			SnakeOilKeyPath:  sc.SnakeOilKeyPath,
+			TLS:              sc.TLS,
+			Protocol:         sc.Protocol,
+			Mode:             sc.Mode,
+		})
+	}
+
+	for i, l := range sc.Listeners {
+		if strings.TrimSpace(l.Name) == "" {
+			errMsg := fmt.Sprintf("invalid empty name for listener block in index %v, please provide a valid name", i)
+			return invalidConfErr(fp, errMsg)
+		}
+		for _, prev := range sc.listeners {
+			if prev.Name == l.Name {
+				errMsg := fmt.Sprintf("listener with name %v already exists", l.Name)
+				return invalidConfErr(fp, errMsg)
+			}
+		}
+
+		if l.ListenAddr == nil || *l.ListenAddr == "" {
+			errMsg := fmt.Sprintf("%s field null or empty for listener \"%s\"", listenAddrField, l.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		if err := validateListenAddr(fp, *l.ListenAddr, fmt.Sprintf(" for listener \"%s\"", l.Name)); err != nil {
+			return err
+		}
+
+		if (l.SnakeOilCertPath == nil) != (l.SnakeOilKeyPath == nil) {
+			errMsg := fmt.Sprintf("snake_oil_cert and snake_oil_key should be set together for listener \"%s\"", l.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		l.Mode = HTTP
+		if l.SnakeOilCertPath != nil || (l.TLS != nil && l.TLS.Auto) {
+			l.Mode = HTTPS
+		}
+		sc.listeners = append(sc.listeners, l)
+	}
+
+	for _, l := range sc.listeners {
+		if err := validateListenerProtocol(fp, l); err != nil {
+			return err
+		}
+		if l.TLS == nil {
+			continue
+		}
+		owner := fmt.Sprintf("listener \"%s\"", l.Name)
+		if l.Mode != HTTPS {
+			errMsg := fmt.Sprintf("tls block needs snake_oil_cert and snake_oil_key or auto = true for %s", owner)
+			return invalidConfErr(fp, errMsg)
+		}
+		if l.TLS.Auto && (l.SnakeOilCertPath != nil || l.SnakeOilKeyPath != nil) {
+			errMsg := fmt.Sprintf("tls auto cannot be used with snake_oil_cert and snake_oil_key for %s", owner)
+			return invalidConfErr(fp, errMsg)
+		}
+		if err := validateTLS(fp, owner, l.TLS); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]string)
+	for _, l := range sc.listeners {
+		// every listener on port 0 gets a port of its own
+		if strings.HasSuffix(*l.ListenAddr, ":0") {
+			continue
+		}
+		if prev, present := seen[*l.ListenAddr]; present {
+			errMsg := fmt.Sprintf("listeners \"%s\" and \"%s\" both listen on %s", prev, l.Name, *l.ListenAddr)
+			return invalidConfErr(fp, errMsg)
+		}
+		seen[*l.ListenAddr] = l.Name
+	}
+	return nil
+}
+
+//validateListenAddr checks addr is of the form "<server>:<port>", where is
+//added to errors to tell which listener the address belongs to
+func validateListenAddr(fp, addr, where string) error {
+	res := listenAddrRegex.FindStringSubmatch(addr)
+
+	if len(res) != 3 {
+		errMsg := fmt.Sprintf("expected field %s to be \"<server>:<port>\" found \"%s\"%s", listenAddrField, addr, where)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	// not worried about err here see regex we match \d+
+	port, _ := strconv.Atoi(res[2])
+	if port < 0 || port > maxPortNum {
+		errMsg := fmt.Sprintf("port numbers can only be 0 < port < %v found %v in %s=%s%s", maxPortNum, port, listenAddrField, addr, where)
+		return invalidConfErr(fp, errMsg)
+	}
+	log.Infof("will start server in address: %v%s", addr, where)
+	return nil
+}
+
+//validateListenerMocks checks every mock or grpc mock a listener serves is
+//configured
+func validateListenerMocks(fp string, listeners []*Listener, mocks []*Mock, grpcMocks []*GRPCMock) error {
+	for _, l := range listeners {
+		for _, name := range l.Mocks {
+			if mockIndex(mocks, name) < 0 && grpcMockIndex(grpcMocks, name) < 0 {
+				errMsg := fmt.Sprintf("listener \"%s\" serves mock \"%s\" which is not configured", l.Name, name)
+				return invalidConfErr(fp, errMsg)
+			}
+		}
+	}
+	return nil
+}
+
+//mockListeners maps the names of mocks to the names of the listeners that
+//serve them, mocks served on every listener are left out
+func mockListeners(listeners []*Listener, mocks []*Mock) map[string]map[string]bool {
+	names := make([]string, 0, len(mocks))
+	for _, m := range mocks {
+		names = append(names, m.Name)
+	}
+	return listenersServing(listeners, names)
+}
+
+//grpcMockListeners is mockListeners for grpc mocks
+func grpcMockListeners(listeners []*Listener, grpcMocks []*GRPCMock) map[string]map[string]bool {
+	names := make([]string, 0, len(grpcMocks))
+	for _, gm := range grpcMocks {
+		names = append(names, gm.Name)
+	}
+	return listenersServing(listeners, names)
+}
+
+//listenersServing maps every mock name in mockNames to the names of the
+//listeners that serve it, mocks served on every listener are left out
+func listenersServing(listeners []*Listener, mockNames []string) map[string]map[string]bool {
+	served := make(map[string]map[string]bool)
+	for _, mockName := range mockNames {
+		names := make(map[string]bool)
+		for _, l := range listeners {
+			if len(l.Mocks) == 0 {
+				names[l.Name] = true
+				continue
+			}
+			for _, name := range l.Mocks {
+				if name == mockName {
+					names[l.Name] = true
+				}
+			}
+		}
+		if len(names) < len(listeners) {
+			served[mockName] = names
+		}
+	}
+	return served
+}
+
+//listenerMatcher matches requests that came in on one of the named listeners,
+//requests handed to the server directly and not through a listener match
+func listenerMatcher(names map[string]bool) mux.MatcherFunc {
+	return func(req *http.Request, rm *mux.RouteMatch) bool {
+		return onListener(req.Context(), names)
+	}
+}
+
+//onListener checks if the request of ctx came in on one of the named
+//listeners, requests handed to the server directly are on all of them
+func onListener(ctx context.Context, names map[string]bool) bool {
+	name, ok := listenerFromContext(ctx)
+	return !ok || names[name]
+}
+
+//listenerFromContext returns the name of the listener a request came in on
+func listenerFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(listenerKey).(string)
+	return name, ok
+}
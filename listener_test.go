@@ -0,0 +1,188 @@
+package mockaroo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const listenerTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	listener "payments" {
+		listen_addr = "localhost:5001"
+		mocks       = ["charges"]
+	}
+
+	listener "users" {
+		listen_addr = "localhost:5002"
+		mocks       = ["users", "health"]
+	}
+
+	mock "charges" {
+		request {
+			path = "/v1/charges"
+			verb = "GET"
+		}
+		response {
+			body = "charges"
+		}
+	}
+
+	mock "users" {
+		request {
+			path = "/v1/users"
+			verb = "GET"
+		}
+		response {
+			body = "users"
+		}
+	}
+
+	mock "health" {
+		request {
+			path = "/health"
+			verb = "GET"
+		}
+		response {
+			body = "ok"
+		}
+	}
+}
+`
+
+func TestListenersServeTheirMocks(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(listenerTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	if len(ts.URLs) != 3 || ts.URL != ts.URLs[defaultListenerName] {
+		t.Fatalf("expected 3 listeners with the default one first but found:%v url:%v", ts.URLs, ts.URL)
+	}
+
+	tests := []struct {
+		listener string
+		path     string
+		status   int
+	}{
+		{"default", "/v1/charges", http.StatusOK},
+		{"default", "/v1/users", http.StatusOK},
+		{"default", "/health", http.StatusOK},
+		{"payments", "/v1/charges", http.StatusOK},
+		{"payments", "/v1/users", http.StatusNotFound},
+		{"payments", "/health", http.StatusNotFound},
+		{"users", "/v1/charges", http.StatusNotFound},
+		{"users", "/v1/users", http.StatusOK},
+		{"users", "/health", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Get(ts.URLs[test.listener] + test.path)
+		if err != nil {
+			t.Fatalf("request to listener %v failed with error:%v", test.listener, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("listener:%v path:%v expected status:%v found:%v", test.listener, test.path, test.status, resp.StatusCode)
+		}
+		// mocks of other listeners are not near misses
+		if resp.StatusCode == http.StatusNotFound && strings.Contains(string(body), "\"mock\"") {
+			t.Errorf("listener:%v path:%v expected no near misses found:%s", test.listener, test.path, body)
+		}
+	}
+
+	reqs := ts.Requests(RequestFilter{Path: "/v1/users"})
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 requests to /v1/users in the journal found:%v", len(reqs))
+	}
+	for i, expected := range []string{"default", "payments", "users"} {
+		if reqs[i].Listener != expected {
+			t.Errorf("expected request %v to be on listener:%v found:%v", i, expected, reqs[i].Listener)
+		}
+	}
+}
+
+func TestStartServesEveryListener(t *testing.T) {
+	src := strings.Replace(listenerTestConfig, "localhost:500", "127.0.0.1:", -1)
+	src = strings.Replace(src, "127.0.0.1:1", "127.0.0.1:0", -1)
+	src = strings.Replace(src, "127.0.0.1:2", "127.0.0.1:0", -1)
+	conf, err := LoadConfigFromBytes([]byte(src))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+
+	s := NewServer(conf).(*muxServer)
+	done := make(chan error)
+	go func() {
+		done <- s.Start()
+	}()
+	waitForAddr(t, s)
+
+	s.mu.Lock()
+	addrs := make([]string, 0, len(s.listeners))
+	for _, ln := range s.listeners {
+		addrs = append(addrs, ln.Addr().String())
+	}
+	s.mu.Unlock()
+	if len(addrs) < 3 {
+		t.Fatalf("expected 3 listeners found:%v", addrs)
+	}
+
+	for i, path := range []string{"/health", "/v1/charges", "/v1/users"} {
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", addrs[i], path))
+		if err != nil {
+			t.Fatalf("request to %v failed with error:%v", addrs[i], err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected %v on %v to be 200 found:%v", path, addrs[i], resp.StatusCode)
+		}
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed with error:%v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected start to return no error after shutdown found:%v", err)
+	}
+	for _, addr := range addrs {
+		if _, err := http.Get(fmt.Sprintf("http://%s/health", addr)); err == nil {
+			t.Errorf("expected request to %v after shutdown to fail", addr)
+		}
+	}
+}
+
+func TestInvalidListenerConfigs(t *testing.T) {
+	mock := "mock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n}\nresponse {\nbody = \"a\"\n}\n}\n"
+	invalid := map[string]string{
+		"no address":        ``,
+		"listener no addr":  `listener "a" {}`,
+		"bad addr":          `listener "a" { listen_addr = "localhost" }`,
+		"duplicate name":    `listener "a" { listen_addr = "localhost:5001" } ` + "\n" + `listener "a" { listen_addr = "localhost:5002" }`,
+		"default name":      `listen_addr = "localhost:5000"` + "\n" + `listener "default" { listen_addr = "localhost:5001" }`,
+		"duplicate address": `listen_addr = "localhost:5000"` + "\n" + `listener "a" { listen_addr = "localhost:5000" }`,
+		"cert without key":  `listener "a" {` + "\n" + `listen_addr = "localhost:5001"` + "\n" + `snake_oil_cert = "a.crt"` + "\n}",
+		"unknown mock":      `listener "a" {` + "\n" + `listen_addr = "localhost:5001"` + "\n" + `mocks = ["nope"]` + "\n}",
+	}
+
+	for name, server := range invalid {
+		src := "server {\n" + server + "\n" + mock + "}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil {
+			t.Errorf("%v: expected config load to fail", name)
+		}
+	}
+
+	// listeners alone are enough
+	src := "server {\nlistener \"a\" {\nlisten_addr = \"localhost:5001\"\n}\n" + mock + "}\n"
+	if _, err := LoadConfigFromBytes([]byte(src)); err != nil {
+		t.Errorf("expected config with only listener blocks to load found:%v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package mockaroo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// most near misses reported for a request
+const maxNearMisses = 5
+
+//NearMiss is a mock whose path matched a request that it did not match
+//along with the matchers of the mock that failed
+type NearMiss struct {
+	MockName string   `json:"mock"`
+	Failed   []string `json:"failed"`
+}
+
+//notFoundReport is the JSON body returned for requests no mock matched
+type notFoundReport struct {
+	Message    string      `json:"message"`
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	NearMisses []*NearMiss `json:"near_misses"`
+}
+
+//matcherCheck is a single matcher of a mock checked on its own
+type matcherCheck struct {
+	// what is reported when the check fails
+	description string
+	route       *mux.Route
+}
+
+//mockChecks are all matchers of a mock checked one by one
+type mockChecks struct {
+	mock   *Mock
+	path   *mux.Route
+	checks []matcherCheck
+}
+
+//diagnostics finds the mocks that came closest to matching a request
+type diagnostics struct {
+	mocks []*mockChecks
+}
+
+//newDiagnostics sets up checks for every matcher of every mock, the
+//matchers are expected to be validated, mocks are only reported for
+//requests on the listeners in served which serve them
+func (s *muxServer) newDiagnostics(mocks []*Mock, served map[string]map[string]bool) *diagnostics {
+	d := &diagnostics{}
+	for _, m := range sortMocks(mocks) {
+		mc := &mockChecks{mock: m, path: new(mux.Route)}
+		if names, ok := served[m.Name]; ok {
+			mc.path.MatcherFunc(listenerMatcher(names))
+		}
+		if m.Request.PathPrefix {
+			mc.path.PathPrefix(m.Request.NormalizedPath)
+		} else {
+			mc.path.Path(m.Request.NormalizedPath)
+		}
+
+		add := func(description string, route *mux.Route) {
+			mc.checks = append(mc.checks, matcherCheck{description: description, route: route})
+		}
+		if m.Request.Host != nil {
+			add(fmt.Sprintf("host should match \"%s\"", *m.Request.Host), new(mux.Route).Host(hostTemplate(*m.Request.Host)))
+		}
+		if m.Request.Scheme != nil {
+			add(fmt.Sprintf("scheme should be %s", *m.Request.Scheme), new(mux.Route).Schemes(*m.Request.Scheme))
+		}
+		if len(m.Request.clientNets) > 0 {
+			add(fmt.Sprintf("client address should be in %s", strings.Join(m.Request.ClientCIDRs, ", ")), new(mux.Route).MatcherFunc(clientCIDRMatcher(m.Request.clientNets)))
+		}
+		if m.Request.ClientCert != nil {
+			add("client certificate should match", new(mux.Route).MatcherFunc(clientCertMatcher(m.Request.ClientCert)))
+		}
+		if m.Request.Protocol != nil {
+			add(fmt.Sprintf("protocol should be %s", *m.Request.Protocol), new(mux.Route).MatcherFunc(protocolMatcher(*m.Request.Protocol)))
+		}
+		for k, v := range m.Request.Headers {
+			add(fmt.Sprintf("header \"%s\" should match \"%s\"", k, v), new(mux.Route).HeadersRegexp(k, v))
+		}
+		for k, v := range m.Request.Queries {
+			add(fmt.Sprintf("query param \"%s\" should match \"%s\"", k, v), new(mux.Route).Queries(k, v))
+		}
+		for k, v := range m.Request.Form {
+			form := map[string]string{k: v}
+			add(fmt.Sprintf("form field \"%s\" should match \"%s\"", k, v), new(mux.Route).MatcherFunc(formMatcher(form, nil)))
+		}
+		for _, fm := range m.Request.Files {
+			files := []*FileMatcher{fm}
+			add(fmt.Sprintf("file \"%s\" should be uploaded", fm.Field), new(mux.Route).MatcherFunc(formMatcher(nil, files)))
+		}
+		if m.Request.Body != nil {
+			add("body should match", new(mux.Route).MatcherFunc(bodyMatcher(m.Request.Body)))
+		}
+		if sc := m.Scenario; sc != nil && sc.State != nil {
+			add(fmt.Sprintf("scenario \"%s\" should be in state \"%s\"", sc.Name, *sc.State), new(mux.Route).MatcherFunc(s.scenarios.scenarioMatcher(sc)))
+		}
+		d.mocks = append(d.mocks, mc)
+	}
+	return d
+}
+
+//nearMisses returns the mocks whose path matched req with the matchers
+//that failed, fewest failures first
+func (d *diagnostics) nearMisses(req *http.Request) []*NearMiss {
+	misses := []*NearMiss{}
+	for _, mc := range d.mocks {
+		if !mc.path.Match(req, &mux.RouteMatch{}) {
+			continue
+		}
+
+		nm := &NearMiss{MockName: mc.mock.Name, Failed: []string{}}
+		if *mc.mock.Request.Verb != req.Method {
+			nm.Failed = append(nm.Failed, fmt.Sprintf("verb should be %s", *mc.mock.Request.Verb))
+		}
+		for _, c := range mc.checks {
+			if !c.route.Match(req, &mux.RouteMatch{}) {
+				nm.Failed = append(nm.Failed, c.description)
+			}
+		}
+		misses = append(misses, nm)
+	}
+
+	sort.SliceStable(misses, func(i, j int) bool {
+		return len(misses[i].Failed) < len(misses[j].Failed)
+	})
+	if len(misses) > maxNearMisses {
+		misses = misses[:maxNearMisses]
+	}
+	return misses
+}
+
+//handler answers requests no mock matched with status and a JSON report of
+//the near misses which also goes in the request log
+func (d *diagnostics) handler(status int, message string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		log.Warnf("request path :%v lead to %v", req.RequestURI, status)
+
+		report := &notFoundReport{
+			Message:    message,
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			NearMisses: d.nearMisses(req),
+		}
+		if rl := requestLogFromContext(req.Context()); rl != nil {
+			rl.NearMisses = report.NearMisses
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	})
+}
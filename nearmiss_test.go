@@ -0,0 +1,162 @@
+package mockaroo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const nearMissTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	mock "user_v2" {
+		request {
+			path = "/users/{id}"
+			verb = "GET"
+			headers = {
+				version = "^2$"
+			}
+			queries = {
+				expand = "true"
+			}
+		}
+		response {
+			body = "user v2"
+		}
+	}
+
+	mock "create_user" {
+		request {
+			path = "/users/{id}"
+			verb = "POST"
+		}
+		response {
+			body = "created"
+		}
+	}
+
+	mock "orders" {
+		request {
+			path = "/orders"
+			verb = "GET"
+			headers = {
+				accept = "json"
+			}
+		}
+		response {
+			body = "orders"
+		}
+	}
+}
+`
+
+func TestNotFoundReportsNearMisses(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(nearMissTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/users/42?expand=true", nil)
+	req.Header.Set("version", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	defer resp.Body.Close()
+
+	// a mock with the same path and another verb makes it a 405
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 found:%v", resp.StatusCode)
+	}
+
+	var report notFoundReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("expected JSON report found error:%v", err)
+	}
+	if report.Message != "method not allowed" || report.Method != http.MethodGet || report.Path != "/users/42" {
+		t.Errorf("unexpected report:%+v", report)
+	}
+
+	// the GET mock missed only on the header so it comes first
+	if len(report.NearMisses) != 2 {
+		t.Fatalf("expected 2 near misses found:%+v", report.NearMisses)
+	}
+	first, second := report.NearMisses[0], report.NearMisses[1]
+	if first.MockName != "user_v2" || len(first.Failed) != 1 || !strings.Contains(first.Failed[0], "header \"version\"") {
+		t.Errorf("expected user_v2 to miss on the version header found:%+v", first)
+	}
+	if second.MockName != "create_user" || len(second.Failed) != 1 || !strings.Contains(second.Failed[0], "verb should be POST") {
+		t.Errorf("expected create_user to miss on the verb found:%+v", second)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/orders", nil)
+	req.Header.Set("accept", "xml")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	defer resp.Body.Close()
+
+	report = notFoundReport{}
+	json.NewDecoder(resp.Body).Decode(&report)
+	if resp.StatusCode != http.StatusNotFound || report.Message != "request not found" {
+		t.Errorf("expected 404 found:%v %+v", resp.StatusCode, report)
+	}
+	if len(report.NearMisses) != 1 || report.NearMisses[0].MockName != "orders" || len(report.NearMisses[0].Failed) != 1 {
+		t.Errorf("expected orders to miss on the accept header found:%+v", report.NearMisses)
+	}
+
+	logs := ts.Requests(RequestFilter{Unmatched: true})
+	if len(logs) != 2 || len(logs[0].NearMisses) != 2 || len(logs[1].NearMisses) != 1 {
+		t.Errorf("expected near misses in the request log found:%+v", logs)
+	}
+}
+
+func TestNearMissesOfUnknownPath(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(nearMissTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	s := &muxServer{conf: conf}
+	s.router = s.newRouter(conf)
+
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, createGetRequest(t, "/nothing/here", nil))
+
+	var report notFoundReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("expected JSON report found error:%v", err)
+	}
+	if rr.Code != http.StatusNotFound || report.NearMisses == nil || len(report.NearMisses) != 0 {
+		t.Errorf("expected 404 with no near misses found:%v %+v", rr.Code, report)
+	}
+}
+
+func TestMethodNotAllowedReportsNearMisses(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(nearMissTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	s := &muxServer{conf: conf}
+	s.router = s.newRouter(conf)
+
+	req := httptest.NewRequest(http.MethodDelete, "/orders", nil)
+	req.Header.Set("accept", "json")
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+
+	var report notFoundReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("expected JSON report found error:%v", err)
+	}
+	if rr.Code != http.StatusMethodNotAllowed || len(report.NearMisses) != 1 || report.NearMisses[0].MockName != "orders" {
+		t.Fatalf("expected 405 with orders as near miss found:%v %+v", rr.Code, report)
+	}
+	if failed := report.NearMisses[0].Failed; len(failed) != 1 || failed[0] != "verb should be GET" {
+		t.Errorf("expected orders to miss on the verb found:%v", failed)
+	}
+}
@@ -0,0 +1,168 @@
+package mockaroo
+
+import (
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// kinds of path segments from the least to the most specific
+const (
+	segmentPrefix = iota // the trailing "**" matching anything below
+	segmentVar
+	segmentPatternVar // a variable constrained by a regexp like {id:[0-9]+}
+	segmentLiteral
+)
+
+type pathSegment struct {
+	kind int
+	text string
+}
+
+//pathSegments splits the normalized path of a mock into typed segments
+func pathSegments(req *Request) []pathSegment {
+	parts := strings.Split(req.NormalizedPath, "/")[1:]
+	if req.PathPrefix {
+		// the "**" was normalized to an empty last element
+		parts = parts[:len(parts)-1]
+	}
+
+	segments := make([]pathSegment, 0, len(parts)+1)
+	for _, p := range parts {
+		switch {
+		case strings.HasPrefix(p, "{") && strings.Contains(p, ":"):
+			segments = append(segments, pathSegment{segmentPatternVar, p[strings.Index(p, ":"):]})
+		case strings.HasPrefix(p, "{"):
+			segments = append(segments, pathSegment{segmentVar, ""})
+		default:
+			segments = append(segments, pathSegment{segmentLiteral, p})
+		}
+	}
+	if req.PathPrefix {
+		segments = append(segments, pathSegment{kind: segmentPrefix})
+	}
+	return segments
+}
+
+//extraMatchers counts the matchers of mock beyond path and verb
+func extraMatchers(m *Mock) int {
+	n := len(m.Request.Headers) + len(m.Request.Queries) + len(m.Request.Form) + len(m.Request.Files)
+	if m.Request.Body != nil {
+		n++
+	}
+	if m.Request.Host != nil {
+		n++
+	}
+	if m.Request.Scheme != nil {
+		n++
+	}
+	if len(m.Request.ClientCIDRs) > 0 {
+		n++
+	}
+	if m.Request.ClientCert != nil {
+		n++
+	}
+	if m.Request.Protocol != nil {
+		n++
+	}
+	if m.Scenario != nil && m.Scenario.State != nil {
+		n++
+	}
+	return n
+}
+
+//moreSpecific reports whether mock a should be tried before mock b when
+//both have the same priority, segments are compared left to right with
+//literals before variables with a regexp before plain variables before "**",
+//then longer paths before shorter ones and mocks with more matchers before
+//those with fewer
+func moreSpecific(a, b *Mock) bool {
+	as, bs := pathSegments(a.Request), pathSegments(b.Request)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i].kind != bs[i].kind {
+			return as[i].kind > bs[i].kind
+		}
+	}
+	if len(as) != len(bs) {
+		return len(as) > len(bs)
+	}
+	return extraMatchers(a) > extraMatchers(b)
+}
+
+//sortMocks returns the mocks in the order they are tried, higher priority
+//first then more specific first, mocks alike keep their declaration order
+func sortMocks(mocks []*Mock) []*Mock {
+	sorted := append([]*Mock{}, mocks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return moreSpecific(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+//covers reports whether every path matched by mock b is also matched by mock a
+func covers(a, b *Mock) bool {
+	as, bs := pathSegments(a.Request), pathSegments(b.Request)
+	for i, seg := range as {
+		if seg.kind == segmentPrefix {
+			return true
+		}
+		if i >= len(bs) {
+			return false
+		}
+		switch seg.kind {
+		case segmentVar:
+			if bs[i].kind == segmentPrefix {
+				return false
+			}
+		default:
+			if seg != bs[i] {
+				return false
+			}
+		}
+	}
+	return len(as) == len(bs)
+}
+
+//shadows reports whether mock a always matches the requests mock b matches
+//so that b never matches when a is tried first
+func shadows(a, b *Mock) bool {
+	return *a.Request.Verb == *b.Request.Verb && extraMatchers(a) == 0 && covers(a, b)
+}
+
+//servedWherever reports whether mock a is served on every listener mock b
+//is served on, served is as returned by mockListeners
+func servedWherever(a, b *Mock, served map[string]map[string]bool) bool {
+	as, aPartial := served[a.Name]
+	bs, bPartial := served[b.Name]
+	if !aPartial {
+		return true
+	}
+	if !bPartial {
+		return false
+	}
+	for name := range bs {
+		if !as[name] {
+			return false
+		}
+	}
+	return true
+}
+
+//warnShadowedMocks logs a warning for every mock that can never match
+//because a mock tried before it always matches first, served is as
+//returned by mockListeners
+func warnShadowedMocks(mocks []*Mock, served map[string]map[string]bool) {
+	sorted := sortMocks(mocks)
+	for j, b := range sorted {
+		for _, a := range sorted[:j] {
+			if shadows(a, b) && servedWherever(a, b, served) {
+				log.Warnf("mock:\"%v\" can never match, mock:\"%v\" with path:\"%v\" always matches first", b.Name, a.Name, *a.Request.Path)
+				break
+			}
+		}
+	}
+}
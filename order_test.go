@@ -0,0 +1,238 @@
+package mockaroo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func routeBody(t *testing.T, s *muxServer, path string, headers map[string]string) string {
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, createGetRequest(t, path, headers))
+	if rr.Code != http.StatusOK {
+		return ""
+	}
+	return strings.TrimSpace(rr.Body.String())
+}
+
+func TestMocksAreTriedBySpecificity(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(`
+	server {
+		listen_addr = "localhost:5000"
+
+		mock "all_users" {
+			request {
+				path = "/users/**"
+				verb = "GET"
+			}
+			response {
+				body = "all"
+			}
+		}
+
+		mock "user" {
+			request {
+				path = "/users/{id}"
+				verb = "GET"
+			}
+			response {
+				body = "user {{.PathVariable \"id\"}}"
+			}
+		}
+
+		mock "me" {
+			request {
+				path = "/users/me"
+				verb = "GET"
+			}
+			response {
+				body = "me"
+			}
+		}
+
+		mock "user_v2" {
+			request {
+				path = "/users/{id}"
+				verb = "GET"
+				headers = {
+					version = "2"
+				}
+			}
+			response {
+				body = "user v2"
+			}
+		}
+	}
+	`))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	s := &muxServer{conf: conf}
+	s.router = s.newRouter(conf)
+
+	tests := []struct {
+		path     string
+		headers  map[string]string
+		expected string
+	}{
+		{"/users/42", nil, "user 42"},
+		{"/users/me", nil, "me"},
+		{"/users/42", map[string]string{"version": "2"}, "user v2"},
+		{"/users/42/orders", nil, "all"},
+		{"/users/", nil, "all"},
+	}
+	for _, test := range tests {
+		if body := routeBody(t, s, test.path, test.headers); body != test.expected {
+			t.Errorf("GET %v %v expected body:%v found:%v", test.path, test.headers, test.expected, body)
+		}
+	}
+}
+
+func TestPatternVariablesAreTriedBeforePlainVariables(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(`
+	server {
+		listen_addr = "localhost:5000"
+
+		mock "any" {
+			request {
+				path = "/users/{name}"
+				verb = "GET"
+			}
+			response {
+				body = "any"
+			}
+		}
+
+		mock "num" {
+			request {
+				path = "/users/{id:[0-9]+}"
+				verb = "GET"
+			}
+			response {
+				body = "num"
+			}
+		}
+
+		mock "me" {
+			request {
+				path = "/users/me"
+				verb = "GET"
+			}
+			response {
+				body = "me"
+			}
+		}
+	}
+	`))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+
+	// the order does not depend on the declaration order
+	for _, mocks := range [][]*Mock{conf.ServerConfig.Mocks, {conf.ServerConfig.Mocks[1], conf.ServerConfig.Mocks[0], conf.ServerConfig.Mocks[2]}} {
+		conf.ServerConfig.Mocks = mocks
+		s := &muxServer{conf: conf}
+		s.router = s.newRouter(conf)
+
+		tests := map[string]string{
+			"/users/42":    "num",
+			"/users/alice": "any",
+			"/users/me":    "me",
+		}
+		for path, expected := range tests {
+			if body := routeBody(t, s, path, nil); body != expected {
+				t.Errorf("GET %v expected body:%v found:%v", path, expected, body)
+			}
+		}
+	}
+}
+
+func TestMockPriorityWins(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(`
+	server {
+		listen_addr = "localhost:5000"
+
+		mock "user" {
+			request {
+				path = "/users/{id}"
+				verb = "GET"
+			}
+			response {
+				body = "user"
+			}
+		}
+
+		mock "maintenance" {
+			priority = 10
+			request {
+				path = "/**"
+				verb = "GET"
+			}
+			response {
+				status = 503
+				body = "down for maintenance"
+			}
+		}
+
+		mock "fallback" {
+			priority = -1
+			request {
+				path = "/users/me"
+				verb = "GET"
+			}
+			response {
+				body = "fallback"
+			}
+		}
+	}
+	`))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+
+	sorted := sortMocks(conf.ServerConfig.Mocks)
+	names := []string{sorted[0].Name, sorted[1].Name, sorted[2].Name}
+	if strings.Join(names, ",") != "maintenance,user,fallback" {
+		t.Errorf("expected mocks in order maintenance,user,fallback found:%v", names)
+	}
+
+	s := &muxServer{conf: conf}
+	s.router = s.newRouter(conf)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, createGetRequest(t, "/users/42", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the high priority mock to answer with 503 found:%v", rr.Code)
+	}
+}
+
+func TestShadowedMocks(t *testing.T) {
+	mock := func(path, verb string, headers map[string]string) *Mock {
+		m := &Mock{Name: path, Request: &Request{Path: &path, Verb: &verb, Headers: headers}}
+		if err := validatePath("", m); err != nil {
+			t.Fatalf("invalid test path %v error:%v", path, err)
+		}
+		return m
+	}
+
+	tests := []struct {
+		a, b     *Mock
+		expected bool
+	}{
+		{mock("/users/**", "GET", nil), mock("/users/{id}", "GET", nil), true},
+		{mock("/users/**", "GET", nil), mock("/users/a/b/**", "GET", nil), true},
+		{mock("/users/{id}", "GET", nil), mock("/users/me", "GET", nil), true},
+		{mock("/users/{id}", "GET", nil), mock("/users/{name}", "GET", nil), true},
+		{mock("/users/{id}", "GET", nil), mock("/users/me", "POST", nil), false},
+		{mock("/users/me", "GET", nil), mock("/users/{id}", "GET", nil), false},
+		{mock("/users/{id:[0-9]+}", "GET", nil), mock("/users/me", "GET", nil), false},
+		{mock("/users/{id}", "GET", map[string]string{"a": "b"}), mock("/users/me", "GET", nil), false},
+		{mock("/users/{id}", "GET", nil), mock("/users/**", "GET", nil), false},
+		{mock("/users", "GET", nil), mock("/users/me", "GET", nil), false},
+	}
+	for _, test := range tests {
+		if found := shadows(test.a, test.b); found != test.expected {
+			t.Errorf("expected %v shadows %v to be %v", *test.a.Request.Path, *test.b.Request.Path, test.expected)
+		}
+	}
+}
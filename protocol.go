@@ -0,0 +1,127 @@
+package mockaroo
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	ProtocolAuto  = "auto"
+	ProtocolHTTP1 = "http1"
+	ProtocolHTTP2 = "http2"
+)
+
+// protocols a listener can serve
+var validListenerProtocols = map[string]struct{}{
+	ProtocolAuto:  {},
+	ProtocolHTTP1: {},
+	ProtocolHTTP2: {},
+}
+
+// protocols a request can be matched on and their major version
+var protocolVersions = map[string]int{
+	ProtocolHTTP1: 1,
+	ProtocolHTTP2: 2,
+}
+
+//protocol is the protocol setting of the listener or the default
+func (l *Listener) protocol() string {
+	if l.Protocol == nil {
+		return ProtocolAuto
+	}
+	return *l.Protocol
+}
+
+//validateListenerProtocol checks the protocol setting of listener l
+func validateListenerProtocol(fp string, l *Listener) error {
+	if _, present := validListenerProtocols[l.protocol()]; !present {
+		errMsg := fmt.Sprintf("invalid protocol \"%s\" for listener \"%s\" protocol can only be (auto|http1|http2)", l.protocol(), l.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+	return nil
+}
+
+//validateGRPCListeners checks no http1 listener serves one of grpcMocks,
+//gRPC calls only come in over HTTP/2
+func validateGRPCListeners(fp string, listeners []*Listener, grpcMocks []*GRPCMock) error {
+	served := grpcMockListeners(listeners, grpcMocks)
+	for _, l := range listeners {
+		if l.protocol() != ProtocolHTTP1 {
+			continue
+		}
+		for _, gm := range grpcMocks {
+			if names, present := served[gm.Name]; present && !names[l.Name] {
+				continue
+			}
+			errMsg := fmt.Sprintf("listener \"%s\" with protocol http1 cannot serve grpc_mock \"%s\" gRPC needs http2 or auto", l.Name, gm.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+	}
+	return nil
+}
+
+//validateProtocolMatcher checks the protocol the request of mock should come in with
+func validateProtocolMatcher(fp string, mock *Mock) error {
+	p := mock.Request.Protocol
+	if p == nil {
+		return nil
+	}
+	if _, present := protocolVersions[*p]; !present {
+		errMsg := fmt.Sprintf("invalid request protocol \"%s\" in mock \"%s\" protocol can only be (http1|http2)", *p, mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+	return nil
+}
+
+//protocolMatcher matches requests that came in over protocol
+func protocolMatcher(protocol string) mux.MatcherFunc {
+	major := protocolVersions[protocol]
+	return func(req *http.Request, rm *mux.RouteMatch) bool {
+		return req.ProtoMajor == major
+	}
+}
+
+//configureProtocol sets srv up to serve the protocol of listener l with
+//handler, HTTPS listeners negotiate HTTP/2 with the HTTP/2 support built
+//into net/http and plain HTTP listeners serve HTTP/2 as h2c either with
+//prior knowledge or by upgrading an HTTP/1.1 request
+func configureProtocol(srv *http.Server, l *Listener, handler http.Handler) {
+	srv.Handler = handler
+
+	if l.protocol() == ProtocolHTTP1 {
+		// an empty map turns off HTTP/2 over TLS
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		return
+	}
+
+	if l.protocol() == ProtocolHTTP2 {
+		srv.Handler = http2Only(handler)
+	}
+
+	if l.Mode == HTTP {
+		// registers h2s so that its connections are shut down gracefully
+		// along with srv, this only fails for bad TLS settings which a
+		// plain HTTP server does not use
+		h2s := &http2.Server{}
+		http2.ConfigureServer(srv, h2s)
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+}
+
+//http2Only refuses requests that did not come in over HTTP/2
+func http2Only(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor != 2 {
+			log.Warnf("request path :%v came in over %v on a HTTP/2 only listener", req.RequestURI, req.Proto)
+			http.Error(w, "HTTP/2 required", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
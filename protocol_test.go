@@ -0,0 +1,159 @@
+package mockaroo
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+const protocolTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	listener "http1" {
+		listen_addr = "localhost:5001"
+		protocol    = "http1"
+	}
+
+	listener "http2" {
+		listen_addr = "localhost:5002"
+		protocol    = "http2"
+	}
+
+	listener "tls" {
+		listen_addr = "localhost:5443"
+		tls {
+			auto = true
+		}
+	}
+
+	listener "tls_http1" {
+		listen_addr = "localhost:5444"
+		protocol    = "http1"
+		tls {
+			auto = true
+		}
+	}
+
+	mock "h2" {
+		request {
+			path     = "/proto"
+			verb     = "GET"
+			protocol = "http2"
+		}
+		response {
+			body = "h2 {{.Protocol}}"
+		}
+	}
+
+	mock "h1" {
+		request {
+			path     = "/proto"
+			verb     = "GET"
+			protocol = "http1"
+		}
+		response {
+			body = "h1 {{.Protocol}}"
+		}
+	}
+}
+`
+
+//h2cClient speaks HTTP/2 over plain HTTP with prior knowledge
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+}
+
+func TestProtocols(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(protocolTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	tlsClient := ts.Client()
+	tlsClient.Transport.(*http.Transport).ForceAttemptHTTP2 = true
+
+	tests := []struct {
+		name     string
+		client   *http.Client
+		listener string
+		status   int
+		expected string
+	}{
+		{"http1 on default", http.DefaultClient, defaultListenerName, http.StatusOK, "h1 HTTP/1.1"},
+		{"h2c on default", h2cClient(), defaultListenerName, http.StatusOK, "h2 HTTP/2.0"},
+		{"http1 on http1", http.DefaultClient, "http1", http.StatusOK, "h1 HTTP/1.1"},
+		{"h2c on http1", h2cClient(), "http1", 0, ""},
+		{"http1 on http2", http.DefaultClient, "http2", http.StatusHTTPVersionNotSupported, "HTTP/2 required"},
+		{"h2c on http2", h2cClient(), "http2", http.StatusOK, "h2 HTTP/2.0"},
+		{"tls negotiates h2", tlsClient, "tls", http.StatusOK, "h2 HTTP/2.0"},
+		{"tls http1 only", tlsClient, "tls_http1", http.StatusOK, "h1 HTTP/1.1"},
+	}
+
+	for _, test := range tests {
+		resp, err := test.client.Get(ts.URLs[test.listener] + "/proto")
+		if test.status == 0 {
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("%v: expected request to fail found:%v", test.name, resp.Status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: request failed with error:%v", test.name, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status || strings.TrimSpace(string(body)) != test.expected {
+			t.Errorf("%v: expected %v %q found:%v %q", test.name, test.status, test.expected, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestH2CUpgrade(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(protocolTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/proto", nil)
+	req.Header.Set("Connection", "Upgrade, HTTP2-Settings")
+	req.Header.Set("Upgrade", "h2c")
+	req.Header.Set("HTTP2-Settings", "AAMAAABkAARAAAAAAAIAAAAA")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("upgrade request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Upgrade") != "h2c" {
+		t.Errorf("expected switch to h2c found:%v %v", resp.Status, resp.Header)
+	}
+}
+
+func TestInvalidProtocolConfigs(t *testing.T) {
+	mock := "mock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n%s\n}\nresponse {\nbody = \"a\"\n}\n}\n"
+	invalid := map[string][2]string{
+		"bad listener protocol": {"listen_addr = \"localhost:5000\"\nprotocol = \"spdy\"", ""},
+		"bad request protocol":  {"listen_addr = \"localhost:5000\"", "protocol = \"HTTP/3\""},
+		"protocol no address":   {"listener \"a\" {\nlisten_addr = \"localhost:5001\"\n}\nprotocol = \"http2\"", ""},
+	}
+
+	for name, test := range invalid {
+		src := "server {\n" + test[0] + "\n" + strings.Replace(mock, "%s", test[1], 1) + "}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil {
+			t.Errorf("%v: expected config load to fail", name)
+		}
+	}
+}
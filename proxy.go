@@ -0,0 +1,61 @@
+package mockaroo
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//ProxyResponse forwards the request matched by a mock to URL and sends back the
+//upstream response, Status and Headers if set override what the upstream sent
+type ProxyResponse struct {
+	URL            *string           `hcl:"url" json:"url"`
+	Status         int               `hcl:"status,optional" json:"status,omitempty"`
+	Headers        map[string]string `hcl:"headers,optional" json:"headers,omitempty"`
+	RequestHeaders map[string]string `hcl:"request_headers,optional" json:"request_headers,omitempty"` // set on the forwarded request
+
+	proxy *httputil.ReverseProxy
+}
+
+//newReverseProxy creates a proxy forwarding requests to upstream, the Host
+//header is rewritten so that virtual hosted upstreams work
+func newReverseProxy(upstream *url.URL) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Host = upstream.Host
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		log.Errorf("error proxying %v to %v: %v", req.URL.Path, upstream, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return proxy
+}
+
+//newMockProxy creates the proxy for a mock proxy response applying all
+//the overrides of pr
+func newMockProxy(pr *ProxyResponse, upstream *url.URL) *httputil.ReverseProxy {
+	proxy := newReverseProxy(upstream)
+
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		for k, v := range pr.RequestHeaders {
+			req.Header.Set(k, v)
+		}
+	}
+
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if pr.Status != 0 {
+			resp.StatusCode = pr.Status
+		}
+		for k, v := range pr.Headers {
+			resp.Header.Set(k, v)
+		}
+		return nil
+	}
+	return proxy
+}
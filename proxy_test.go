@@ -0,0 +1,167 @@
+package mockaroo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestProxyFallbackAndProxyResponses(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("X-Backend", "real")
+		w.Header().Set("X-Overridden", "no")
+		fmt.Fprintf(w, "backend %s %s req:%s body:%s", req.Method, req.URL.Path, req.Header.Get("X-Req"), body)
+	}))
+	defer backend.Close()
+
+	sampleConfig := fmt.Sprintf(`
+	server {
+		listen_addr = "localhost:5000"
+		proxy_fallback = "%[1]s"
+
+		mock "mocked" {
+			request {
+				path = "/mocked"
+				verb = "GET"
+			}
+			response {
+				body = "mocked"
+			}
+		}
+
+		mock "overridden" {
+			request {
+				path = "/override/{id}"
+				verb = "POST"
+			}
+			response {
+				proxy {
+					url = "%[1]s"
+					status = 418
+					headers = {
+						X-Overridden = "yes"
+					}
+					request_headers = {
+						X-Req = "added"
+					}
+				}
+			}
+		}
+	}
+	`, backend.URL)
+	conf, err := LoadConfigFromBytes([]byte(sampleConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v>\n%s", err.Error(), sampleConfig)
+	}
+	ts := NewTestServer(t, conf)
+
+	if body := getBody(t, ts.URL+"/mocked"); body != "mocked" {
+		t.Errorf("expected mocked response body:mocked found:%v", body)
+	}
+
+	if body := getBody(t, ts.URL+"/not/mocked"); body != "backend GET /not/mocked req: body:" {
+		t.Errorf("expected unmatched request to reach the backend found:%v", body)
+	}
+
+	// a mocked path with a verb no mock has is forwarded as well
+	resp, err := http.Post(ts.URL+"/mocked", "text/plain", strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "backend POST /mocked req: body:data" {
+		t.Errorf("expected request with unmocked verb to reach the backend found:%v %s", resp.StatusCode, body)
+	}
+
+	resp, err = http.PostForm(ts.URL+"/override/7", url.Values{"amount": {"100"}})
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("expected overridden status 418 found:%v", resp.StatusCode)
+	}
+
+	if resp.Header.Get("X-Overridden") != "yes" || resp.Header.Get("X-Backend") != "real" {
+		t.Errorf("expected overridden and upstream headers found:%v", resp.Header)
+	}
+
+	expected := "backend POST /override/7 req:added body:amount=100"
+	if strings.TrimSpace(string(body)) != expected {
+		t.Errorf("expected proxied body:%v found:%s", expected, body)
+	}
+
+	if err := ts.Verify("overridden", 1); err != nil {
+		t.Errorf("expected proxied request to be journaled against the mock: %v", err)
+	}
+}
+
+func TestProxyConfigValidation(t *testing.T) {
+	invalid := []string{
+		`proxy_fallback = "not a url"`,
+		`proxy_fallback = "http://localhost:1"
+		record {
+			upstream = "http://localhost:1"
+			out = "out.hcl"
+		}`,
+	}
+	for _, serverSetting := range invalid {
+		sampleConfig := fmt.Sprintf(`
+		server {
+			listen_addr = "localhost:5000"
+			%s
+			mock "hello" {
+				request {
+					path = "/hello"
+					verb = "GET"
+				}
+				response {
+					body = "world"
+				}
+			}
+		}
+		`, serverSetting)
+		_, err := LoadConfigFromBytes([]byte(sampleConfig))
+		assertInvalidConfigError(t, err)
+	}
+
+	invalidResponses := []string{
+		`proxy {
+			url = "http://localhost:1"
+		}
+		body = "both"`,
+		`proxy {
+			url = "localhost"
+		}`,
+		`proxy {
+			url = "http://localhost:1"
+			status = 99
+		}`,
+	}
+	for _, response := range invalidResponses {
+		sampleConfig := fmt.Sprintf(`
+		server {
+			listen_addr = "localhost:5000"
+			mock "hello" {
+				request {
+					path = "/hello"
+					verb = "GET"
+				}
+				response {
+					%s
+				}
+			}
+		}
+		`, response)
+		_, err := LoadConfigFromBytes([]byte(sampleConfig))
+		assertInvalidConfigError(t, err)
+	}
+}
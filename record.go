@@ -0,0 +1,268 @@
+package mockaroo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// pseudo file name used in errors for recorded mocks
+	recordConfigName = "<record>"
+
+	// prefix of the mux variables recorded query values are matched with
+	recordedQueryVar = "recorded"
+)
+
+// response headers that describe the connection and not the response,
+// recording them would break the replayed response
+var unrecordedHeaders = map[string]interface{}{
+	"Connection":          nil,
+	"Content-Length":      nil,
+	"Date":                nil,
+	"Keep-Alive":          nil,
+	"Proxy-Authenticate":  nil,
+	"Proxy-Authorization": nil,
+	"Te":                  nil,
+	"Trailer":             nil,
+	"Transfer-Encoding":   nil,
+	"Upgrade":             nil,
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+//recordedRequest is the request as it came in before being proxied
+type recordedRequest struct {
+	method string
+	path   string
+	query  url.Values
+}
+
+//recorder proxies requests to the upstream and keeps every request/response
+//pair as a mock which is written out as HCL after each new recording
+type recorder struct {
+	conf       *RecordConf
+	listenAddr string
+	proxy      *httputil.ReverseProxy
+
+	// guards everything below, recordings come in from many requests
+	mu    sync.Mutex
+	mocks []*Mock
+	seen  map[string]interface{}
+	names map[string]int
+}
+
+func newRecorder(rc *RecordConf, listenAddr string) *recorder {
+	r := &recorder{
+		conf:       rc,
+		listenAddr: listenAddr,
+		seen:       make(map[string]interface{}),
+		names:      make(map[string]int),
+	}
+	r.proxy = newReverseProxy(rc.upstreamURL)
+	r.proxy.ModifyResponse = r.capture
+	return r
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	log.Infof("recording %v %v from upstream %v", req.Method, req.URL.Path, *r.conf.Upstream)
+
+	in := &recordedRequest{method: req.Method, path: req.URL.Path, query: req.URL.Query()}
+	r.proxy.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), recordRequestKey, in)))
+}
+
+//capture records the upstream response and hands an untouched copy of it
+//back to the proxy
+func (r *recorder) capture(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	in, ok := resp.Request.Context().Value(recordRequestKey).(*recordedRequest)
+	if !ok {
+		return nil
+	}
+
+	if err := r.record(in, resp, body); err != nil {
+		// failing to record should not fail the proxied request
+		log.Errorf("error recording %v %v: %v", in.method, in.path, err)
+	}
+	return nil
+}
+
+func (r *recorder) record(in *recordedRequest, resp *http.Response, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the first response for a request is the one that is kept
+	key := fmt.Sprintf("%s %s?%s", in.method, in.path, in.query.Encode())
+	if _, present := r.seen[key]; present {
+		return nil
+	}
+	r.seen[key] = nil
+
+	mock := &Mock{
+		Name: r.mockName(in),
+		Request: &Request{
+			Path: &in.path,
+			Verb: &in.method,
+		},
+		Response: &Response{
+			Status:  resp.StatusCode,
+			Headers: make(map[string]string),
+		},
+	}
+
+	if len(in.query) > 0 {
+		// mux takes every variable name once per route so each key gets
+		// its own, the keys are sorted to name them the same every time
+		keys := make([]string, 0, len(in.query))
+		for k := range in.query {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		mock.Request.Queries = make(map[string]string)
+		for i, k := range keys {
+			mock.Request.Queries[k] = exactQuery(fmt.Sprintf("%s%d", recordedQueryVar, i), in.query.Get(k))
+		}
+	}
+
+	for k, v := range resp.Header {
+		if _, skip := unrecordedHeaders[http.CanonicalHeaderKey(k)]; !skip {
+			mock.Response.Headers[k] = strings.Join(v, ", ")
+		}
+	}
+
+	// encoded or binary bodies go to a file, text goes straight in the HCL
+	if resp.Header.Get("Content-Encoding") != "" || !utf8.Valid(body) {
+		file, err := r.writeBodyFile(mock.Name, body)
+		if err != nil {
+			return err
+		}
+		mock.Response.ResponseFile = &file
+	} else {
+		text := escapeTemplate(string(body))
+		mock.Response.ResponseBody = &text
+	}
+
+	// make sure the recording can be loaded back
+	if err := validateMock(recordConfigName, mock); err != nil {
+		return err
+	}
+
+	r.mocks = append(r.mocks, mock)
+	log.Infof("recorded mock:\"%v\" to %v", mock.Name, *r.conf.Out)
+	return r.save()
+}
+
+//mockName derives a unique mock name from the verb and path
+func (r *recorder) mockName(in *recordedRequest) string {
+	name := strings.Trim(nonNameChars.ReplaceAllString(in.path, "_"), "_")
+	if name == "" {
+		name = "root"
+	}
+	name = strings.ToLower(in.method) + "_" + name
+
+	r.names[name]++
+	if n := r.names[name]; n > 1 {
+		name = fmt.Sprintf("%s_%d", name, n)
+	}
+	return name
+}
+
+//writeBodyFile writes body next to the out file and returns the absolute path
+func (r *recorder) writeBodyFile(name string, body []byte) (string, error) {
+	out := *r.conf.Out
+	dir := strings.TrimSuffix(out, filepath.Ext(out)) + "_files"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	file, err := filepath.Abs(filepath.Join(dir, name+".body"))
+	if err != nil {
+		return "", err
+	}
+	return file, ioutil.WriteFile(file, body, 0644)
+}
+
+//save writes all recorded mocks as a config file that can be loaded directly,
+//the file is replaced atomically so a crash never leaves half a file behind
+func (r *recorder) save() error {
+	f := hclwrite.NewEmptyFile()
+	server := f.Body().AppendNewBlock("server", nil).Body()
+	server.SetAttributeValue(listenAddrField, cty.StringVal(r.listenAddr))
+
+	for _, m := range r.mocks {
+		server.AppendNewline()
+		mock := server.AppendNewBlock("mock", []string{m.Name}).Body()
+
+		req := mock.AppendNewBlock("request", nil).Body()
+		req.SetAttributeValue("path", cty.StringVal(*m.Request.Path))
+		req.SetAttributeValue("verb", cty.StringVal(*m.Request.Verb))
+		if len(m.Request.Queries) > 0 {
+			req.SetAttributeValue("queries", stringMapVal(m.Request.Queries))
+		}
+
+		resp := mock.AppendNewBlock("response", nil).Body()
+		resp.SetAttributeValue("status", cty.NumberIntVal(int64(m.Response.Status)))
+		if len(m.Response.Headers) > 0 {
+			resp.SetAttributeValue("headers", stringMapVal(m.Response.Headers))
+		}
+		if m.Response.ResponseFile != nil {
+			resp.SetAttributeValue("file", cty.StringVal(*m.Response.ResponseFile))
+		} else {
+			resp.SetAttributeValue("body", cty.StringVal(*m.Response.ResponseBody))
+		}
+	}
+
+	out := *r.conf.Out
+	tmp := out + ".tmp"
+	if err := ioutil.WriteFile(tmp, f.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+//stringMapVal converts m to an object value, the keys are written out sorted
+func stringMapVal(m map[string]string) cty.Value {
+	vals := make(map[string]cty.Value, len(m))
+	for k, v := range m {
+		vals[k] = cty.StringVal(v)
+	}
+	return cty.ObjectVal(vals)
+}
+
+//exactQuery is a query matcher for exactly value, values that would not pass
+//as a regexp go in a mux pattern for the variable name with the value quoted,
+//the braces are written as hex escapes as mux takes every brace for a variable
+func exactQuery(name, value string) string {
+	if regexp.QuoteMeta(value) == value {
+		return value
+	}
+	quoted := regexp.QuoteMeta(value)
+	quoted = strings.NewReplacer(`\{`, `\x7b`, `\}`, `\x7d`).Replace(quoted)
+	return fmt.Sprintf("{%s:%s}", name, quoted)
+}
+
+//escapeTemplate makes text render as is when used as a response template
+func escapeTemplate(text string) string {
+	return strings.Replace(text, "{{", `{{"{{"}}`, -1)
+}
@@ -0,0 +1,272 @@
+package mockaroo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordModeWritesLoadableMocks(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/charges":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Upstream-Host", req.Host)
+			fmt.Fprintf(w, `{"limit": "%s", "template": "{{.NotATemplate}} ${not_hcl}"}`, req.URL.Query().Get("limit"))
+		case "/v1/logo":
+			w.Header().Set("Content-Type", "image/png")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte{0x89, 0x50, 0x4e, 0x47, 0xff, 0xfe})
+		default:
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "record_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir for testing")
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "recorded.hcl")
+
+	sampleConfig := fmt.Sprintf(`
+	server {
+		listen_addr = "localhost:5000"
+		record {
+			upstream = "%s"
+			out = "%s"
+		}
+	}
+	`, upstream.URL, out)
+	conf, err := LoadConfigFromBytes([]byte(sampleConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v>\n%s", err.Error(), sampleConfig)
+	}
+
+	var recorded map[string]string
+	t.Run("record", func(t *testing.T) {
+		ts := NewTestServer(t, conf)
+		recorded = map[string]string{
+			"/v1/charges?limit=3": getBody(t, ts.URL+"/v1/charges?limit=3"),
+			"/v1/logo":            getBody(t, ts.URL+"/v1/logo"),
+			"/v1/other":           getBody(t, ts.URL+"/v1/other"),
+		}
+
+		expected := `{"limit": "3", "template": "{{.NotATemplate}} ${not_hcl}"}`
+		if recorded["/v1/charges?limit=3"] != expected {
+			t.Errorf("expected proxied body:%v found:%v", expected, recorded["/v1/charges?limit=3"])
+		}
+	})
+	upstream.Close()
+
+	// replay the recording without the upstream
+	replayConf, err := LoadConfig(&out)
+	if err != nil {
+		content, _ := ioutil.ReadFile(out)
+		t.Fatalf("recorded config load failed with error:%v>\n%s", err, content)
+	}
+
+	if len(replayConf.ServerConfig.Mocks) != 3 {
+		t.Fatalf("expected 3 recorded mocks found:%v", len(replayConf.ServerConfig.Mocks))
+	}
+
+	ts := NewTestServer(t, replayConf)
+	for uri, body := range recorded {
+		if replayed := getBody(t, ts.URL+uri); replayed != body {
+			t.Errorf("expected replayed body for %v:%v found:%v", uri, body, replayed)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/logo")
+	if err != nil {
+		t.Fatalf("replay request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("expected replayed status 202 and png content type found:%v %v", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/charges?limit=3")
+	if err != nil {
+		t.Fatalf("replay request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("X-Upstream-Host"), "127.0.0.1:") {
+		t.Errorf("expected host header rewritten to upstream found:%v", resp.Header.Get("X-Upstream-Host"))
+	}
+
+	// queries are matched when replaying
+	resp, err = http.Get(ts.URL + "/v1/charges?limit=4")
+	if err != nil {
+		t.Fatalf("replay request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected request with different query to 404 found:%v", resp.StatusCode)
+	}
+}
+
+func TestRecordConfigValidation(t *testing.T) {
+	for _, upstream := range []string{"", "not a url", "ftp://example.com", "/relative"} {
+		sampleConfig := fmt.Sprintf(`
+		server {
+			listen_addr = "localhost:5000"
+			record {
+				upstream = "%s"
+				out = "out.hcl"
+			}
+		}
+		`, upstream)
+		_, err := LoadConfigFromBytes([]byte(sampleConfig))
+		assertInvalidConfigError(t, err)
+	}
+
+	conf, err := LoadConfigFromBytes([]byte(adminTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	if err := conf.EnableRecording("https://api.example.com", ""); err == nil {
+		t.Errorf("expected enable recording without out file to fail")
+	}
+	if err := conf.EnableRecording("https://api.example.com", "out.hcl"); err != nil {
+		t.Errorf("expected enable recording to succeed found:%v", err)
+	}
+}
+
+func TestRecordModeRecordsUnmockedVerbs(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "upstream %s %s", req.Method, req.URL.Path)
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "record_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir for testing")
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "recorded.hcl")
+
+	sampleConfig := fmt.Sprintf(`
+	server {
+		listen_addr = "localhost:5000"
+		record {
+			upstream = "%s"
+			out = "%s"
+		}
+		mock "list_users" {
+			request {
+				path = "/users"
+				verb = "GET"
+			}
+			response {
+				body = "mocked"
+			}
+		}
+	}
+	`, upstream.URL, out)
+	conf, err := LoadConfigFromBytes([]byte(sampleConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v>\n%s", err.Error(), sampleConfig)
+	}
+	ts := NewTestServer(t, conf)
+
+	if body := getBody(t, ts.URL+"/users"); body != "mocked" {
+		t.Errorf("expected mocked response body:mocked found:%v", body)
+	}
+
+	// the path is mocked but not the verb so the request is recorded
+	resp, err := http.Post(ts.URL+"/users", "text/plain", strings.NewReader("new"))
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "upstream POST /users" {
+		t.Errorf("expected request with unmocked verb to be proxied found:%v %s", resp.StatusCode, body)
+	}
+
+	replayConf, err := LoadConfig(&out)
+	if err != nil {
+		t.Fatalf("recorded config load failed with error:%v", err)
+	}
+	mocks := replayConf.ServerConfig.Mocks
+	if len(mocks) != 1 || *mocks[0].Request.Verb != http.MethodPost || *mocks[0].Request.Path != "/users" {
+		t.Errorf("expected the POST /users exchange to be recorded found:%v mocks", len(mocks))
+	}
+}
+
+func TestRecordModeReplaysQueriesExactly(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "upstream %s", req.URL.Query().Encode())
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "record_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir for testing")
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "recorded.hcl")
+
+	conf, err := LoadConfigFromBytes([]byte(fmt.Sprintf(`
+	server {
+		listen_addr = "localhost:5000"
+		record {
+			upstream = "%s"
+			out = "%s"
+		}
+	}
+	`, upstream.URL, out)))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+
+	// several escaped values on one request each get a variable of their own
+	queries := []url.Values{
+		{"q": {"a(b"}},
+		{"q": {"a.b"}},
+		{"q": {"{x}"}},
+		{"q": {"plain"}},
+		{"a": {"1.5"}, "b": {"x+y"}},
+	}
+	t.Run("record", func(t *testing.T) {
+		ts := NewTestServer(t, conf)
+		for _, q := range queries {
+			getBody(t, ts.URL+"/search?"+q.Encode())
+		}
+	})
+	upstream.Close()
+
+	replayConf, err := LoadConfig(&out)
+	if err != nil {
+		content, _ := ioutil.ReadFile(out)
+		t.Fatalf("recorded config load failed with error:%v>\n%s", err, content)
+	}
+	if len(replayConf.ServerConfig.Mocks) != len(queries) {
+		t.Fatalf("expected %v recorded mocks found:%v", len(queries), len(replayConf.ServerConfig.Mocks))
+	}
+
+	ts := NewTestServer(t, replayConf)
+	for _, q := range queries {
+		if body := getBody(t, ts.URL+"/search?"+q.Encode()); body != "upstream "+q.Encode() {
+			t.Errorf("expected replayed body for %v found:%v", q.Encode(), body)
+		}
+	}
+
+	// recorded values match exactly and not as patterns
+	resp, err := http.Get(ts.URL + "/search?q=axb")
+	if err != nil {
+		t.Fatalf("replay request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected q=axb not to match the recording of q=a.b found:%v", resp.StatusCode)
+	}
+}
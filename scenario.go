@@ -0,0 +1,102 @@
+package mockaroo
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//ScenarioStarted is the state every scenario starts in and is reset to
+	ScenarioStarted = "Started"
+)
+
+//Scenario ties a mock to a named state machine, the mock matches only when the
+//scenario is in State (any state if not set) and moves the scenario to
+//NextState (if set) after responding
+type Scenario struct {
+	Name      string  `hcl:"name,label" json:"name"`
+	State     *string `hcl:"state" json:"state,omitempty"`
+	NextState *string `hcl:"next_state" json:"next_state,omitempty"`
+}
+
+//scenarioStore holds the current state of all scenarios, the zero value
+//is ready to use and every scenario is in ScenarioStarted until moved
+type scenarioStore struct {
+	mu     sync.RWMutex
+	states map[string]string
+}
+
+func (ss *scenarioStore) state(name string) string {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	if state, present := ss.states[name]; present {
+		return state
+	}
+	return ScenarioStarted
+}
+
+func (ss *scenarioStore) set(name, state string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.states == nil {
+		ss.states = make(map[string]string)
+	}
+	ss.states[name] = state
+}
+
+//transition moves the scenario of a mock that just responded to its next
+//state, if another request moved the scenario out of the required state in
+//the meantime the transition is skipped
+func (ss *scenarioStore) transition(sc *Scenario) {
+	if sc == nil || sc.NextState == nil {
+		return
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	current, present := ss.states[sc.Name]
+	if !present {
+		current = ScenarioStarted
+	}
+	if sc.State != nil && *sc.State != current {
+		return
+	}
+
+	if ss.states == nil {
+		ss.states = make(map[string]string)
+	}
+	ss.states[sc.Name] = *sc.NextState
+	log.Infof("scenario:\"%v\" moved from \"%v\" to \"%v\"", sc.Name, current, *sc.NextState)
+}
+
+func (ss *scenarioStore) reset() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.states = nil
+}
+
+//scenarioMatcher matches requests only when the scenario is in the state
+//required by the mock
+func (ss *scenarioStore) scenarioMatcher(sc *Scenario) mux.MatcherFunc {
+	return func(req *http.Request, rm *mux.RouteMatch) bool {
+		return ss.state(sc.Name) == *sc.State
+	}
+}
+
+func (s *muxServer) ScenarioStates() map[string]string {
+	states := make(map[string]string)
+	for _, m := range s.getConf().ServerConfig.Mocks {
+		if m.Scenario != nil {
+			states[m.Scenario.Name] = s.scenarios.state(m.Scenario.Name)
+		}
+	}
+	return states
+}
+
+func (s *muxServer) ResetScenarios() {
+	s.scenarios.reset()
+	log.Info("all scenarios reset to \"" + ScenarioStarted + "\"")
+}
@@ -0,0 +1,146 @@
+package mockaroo
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+const scenarioTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	mock "get_user_missing" {
+		scenario "user" {
+			state = "Started"
+		}
+		request {
+			path = "/user"
+			verb = "GET"
+		}
+		response {
+			status = 404
+			body = "missing"
+		}
+	}
+
+	mock "create_user" {
+		scenario "user" {
+			next_state = "created"
+		}
+		request {
+			path = "/user"
+			verb = "POST"
+		}
+		response {
+			status = 201
+			body = "created"
+		}
+	}
+
+	mock "get_user" {
+		scenario "user" {
+			state = "created"
+		}
+		request {
+			path = "/user"
+			verb = "GET"
+		}
+		response {
+			body = "bob"
+		}
+	}
+
+	mock "delete_user" {
+		scenario "user" {
+			state = "created"
+			next_state = "deleted"
+		}
+		request {
+			path = "/user"
+			verb = "DELETE"
+		}
+		response {
+			status = 204
+			body = ""
+		}
+	}
+}
+`
+
+func TestScenarioStateMachine(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(scenarioTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	// when no mock matches but one with the same path and another verb exists
+	// the router answers 405 method not allowed
+	steps := []struct {
+		method string
+		status int
+		state  string
+	}{
+		{http.MethodGet, http.StatusNotFound, ScenarioStarted},
+		{http.MethodDelete, http.StatusMethodNotAllowed, ScenarioStarted},
+		{http.MethodPost, http.StatusCreated, "created"},
+		{http.MethodGet, http.StatusOK, "created"},
+		{http.MethodDelete, http.StatusNoContent, "deleted"},
+		// no mock matches GET in the deleted state
+		{http.MethodGet, http.StatusMethodNotAllowed, "deleted"},
+	}
+
+	for i, step := range steps {
+		if code := adminCall(t, step.method, ts.URL+"/user", ""); code != step.status {
+			t.Errorf("step %v: expected %v /user to return %v found:%v", i, step.method, step.status, code)
+		}
+		if state := ts.ScenarioStates()["user"]; state != step.state {
+			t.Errorf("step %v: expected scenario state %v found:%v", i, step.state, state)
+		}
+	}
+
+	ts.ResetScenarios()
+	if code := adminCall(t, http.MethodGet, ts.URL+"/user", ""); code != http.StatusNotFound {
+		t.Errorf("expected GET after reset to return 404 found:%v", code)
+	}
+}
+
+func TestScenarioAdminEndpoints(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(scenarioTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	if code := adminCall(t, http.MethodPut, ts.URL+adminScenariosPath+"/user", `{"state": "created"}`); code != http.StatusOK {
+		t.Fatalf("expected set scenario to return 200 found:%v", code)
+	}
+
+	if body := getBody(t, ts.URL+"/user"); body != "bob" {
+		t.Errorf("expected response body:bob in created state found:%v", body)
+	}
+
+	resp, err := http.Get(ts.URL + adminScenariosPath)
+	if err != nil {
+		t.Fatalf("list scenarios failed with error:%v", err)
+	}
+	var states map[string]string
+	json.NewDecoder(resp.Body).Decode(&states)
+	resp.Body.Close()
+	if states["user"] != "created" {
+		t.Errorf("expected scenario user in state created found:%v", states)
+	}
+
+	if code := adminCall(t, http.MethodPost, ts.URL+adminScenarioResetPath, ""); code != http.StatusNoContent {
+		t.Errorf("expected reset scenarios to return 204 found:%v", code)
+	}
+
+	if state := ts.ScenarioStates()["user"]; state != ScenarioStarted {
+		t.Errorf("expected scenario state %v after reset found:%v", ScenarioStarted, state)
+	}
+
+	if code := adminCall(t, http.MethodPut, ts.URL+adminScenariosPath+"/user", `{}`); code != http.StatusBadRequest {
+		t.Errorf("expected set scenario without state to return 400 found:%v", code)
+	}
+}
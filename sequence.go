@@ -0,0 +1,113 @@
+package mockaroo
+
+import (
+	"math/rand"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//SequenceStickOnLast keeps serving the last response once the sequence is exhausted
+	SequenceStickOnLast = "stick_on_last"
+	//SequenceCycle starts over from the first response once the sequence is exhausted
+	SequenceCycle = "cycle"
+)
+
+var validSequences = map[string]struct{}{
+	SequenceStickOnLast: {},
+	SequenceCycle:       {},
+}
+
+//sequenceStore counts the calls served by every mock so successive calls
+//walk through its responses and picks weighted responses at random, the
+//zero value is ready to use
+type sequenceStore struct {
+	mu    sync.Mutex
+	calls map[string]int
+	rng   *rand.Rand
+}
+
+//seed restarts the random choice of weighted responses from seed
+func (ss *sequenceStore) seed(seed int64) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.rng = rand.New(rand.NewSource(seed))
+}
+
+//next returns the index of the response to serve for this call of the
+//mock along with the response and moves the mock along its sequence
+func (ss *sequenceStore) next(mock *Mock) (int, *Response) {
+	if len(mock.Responses) <= 1 {
+		return 0, mock.Response
+	}
+
+	if mock.totalWeight > 0 {
+		return ss.pick(mock)
+	}
+
+	ss.mu.Lock()
+	call := ss.calls[mock.Name]
+	if ss.calls == nil {
+		ss.calls = make(map[string]int)
+	}
+	ss.calls[mock.Name] = call + 1
+	ss.mu.Unlock()
+
+	total := 0
+	for _, r := range mock.Responses {
+		total += r.Repeat
+	}
+	if mock.Sequence != nil && *mock.Sequence == SequenceCycle {
+		call = call % total
+	}
+
+	for i, r := range mock.Responses {
+		if call < r.Repeat {
+			return i, r
+		}
+		call -= r.Repeat
+	}
+	last := len(mock.Responses) - 1
+	return last, mock.Responses[last]
+}
+
+//pick chooses one of the weighted responses of mock at random
+func (ss *sequenceStore) pick(mock *Mock) (int, *Response) {
+	ss.mu.Lock()
+	if ss.rng == nil {
+		ss.rng = rand.New(rand.NewSource(nicePrime))
+	}
+	n := ss.rng.Intn(mock.totalWeight)
+	ss.mu.Unlock()
+
+	for i, r := range mock.Responses {
+		if n < *r.Weight {
+			return i, r
+		}
+		n -= *r.Weight
+	}
+	// weights are validated to add up to totalWeight so this is unreachable
+	last := len(mock.Responses) - 1
+	return last, mock.Responses[last]
+}
+
+//reset starts the sequence of the named mock over, every mock if name is empty
+func (ss *sequenceStore) reset(name string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if name == "" {
+		ss.calls = nil
+		return
+	}
+	delete(ss.calls, name)
+}
+
+func (s *muxServer) ResetSequences(mockName string) {
+	s.sequences.reset(mockName)
+	if mockName == "" {
+		log.Info("response sequences of all mocks reset")
+		return
+	}
+	log.Infof("response sequence of mock:\"%v\" reset", mockName)
+}
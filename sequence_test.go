@@ -0,0 +1,281 @@
+package mockaroo
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const sequenceTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	mock "flaky" {
+		request {
+			path = "/flaky"
+			verb = "GET"
+		}
+		response {
+			status = 503
+			body = "unavailable"
+			repeat = 2
+		}
+		response {
+			body = "ok"
+		}
+	}
+
+	mock "toggle" {
+		sequence = "cycle"
+		request {
+			path = "/toggle"
+			verb = "GET"
+		}
+		response {
+			body = "on"
+		}
+		response {
+			body = "off"
+		}
+	}
+}
+`
+
+func TestResponseSequences(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(sequenceTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	// stick_on_last is the default, the last response is served for ever
+	for i, expected := range []string{"unavailable", "unavailable", "ok", "ok"} {
+		if body := getBody(t, ts.URL+"/flaky"); body != expected {
+			t.Errorf("call %v expected body:%v found:%v", i, expected, body)
+		}
+	}
+
+	for i, expected := range []string{"on", "off", "on", "off"} {
+		if body := getBody(t, ts.URL+"/toggle"); body != expected {
+			t.Errorf("call %v expected body:%v found:%v", i, expected, body)
+		}
+	}
+
+	// resetting one mock leaves the others alone
+	if code := adminCall(t, http.MethodPost, ts.URL+adminSequenceResetPath+"?mock=flaky", ""); code != http.StatusNoContent {
+		t.Fatalf("expected sequence reset to return 204 found:%v", code)
+	}
+	if body := getBody(t, ts.URL+"/flaky"); body != "unavailable" {
+		t.Errorf("expected reset sequence to start over found:%v", body)
+	}
+	if body := getBody(t, ts.URL+"/toggle"); body != "on" {
+		t.Errorf("expected toggle sequence to carry on found:%v", body)
+	}
+
+	if code := adminCall(t, http.MethodPost, ts.URL+adminSequenceResetPath+"?mock=nope", ""); code != http.StatusNotFound {
+		t.Errorf("expected reset of unknown mock to return 404 found:%v", code)
+	}
+
+	ts.ResetSequences("")
+	if body := getBody(t, ts.URL+"/toggle"); body != "on" {
+		t.Errorf("expected reset sequence to start over found:%v", body)
+	}
+}
+
+func TestResponseSequencesThroughAdmin(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(adminTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	newMock := `{
+		"name": "counter",
+		"request": {"path": "/counter", "verb": "GET"},
+		"responses": [{"body": "one"}, {"body": "two"}]
+	}`
+	if code := adminCall(t, http.MethodPost, ts.URL+adminMocksPath, newMock); code != http.StatusCreated {
+		t.Fatalf("expected add mock to return 201 found:%v", code)
+	}
+
+	for i, expected := range []string{"one", "two", "two"} {
+		if body := getBody(t, ts.URL+"/counter"); body != expected {
+			t.Errorf("call %v expected body:%v found:%v", i, expected, body)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + adminMocksPath)
+	if err != nil {
+		t.Fatalf("list mocks failed with error:%v", err)
+	}
+	defer resp.Body.Close()
+	var mocks []map[string]json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&mocks)
+	if len(mocks) != 2 {
+		t.Fatalf("expected 2 mocks found:%v", len(mocks))
+	}
+	if _, present := mocks[0]["response"]; !present {
+		t.Errorf("expected single response mock to be listed with response found:%v", mocks[0])
+	}
+	if _, present := mocks[1]["responses"]; !present {
+		t.Errorf("expected sequence mock to be listed with responses found:%v", mocks[1])
+	}
+
+	both := `{
+		"name": "both",
+		"request": {"path": "/both", "verb": "GET"},
+		"response": {"body": "one"},
+		"responses": [{"body": "two"}]
+	}`
+	if code := adminCall(t, http.MethodPost, ts.URL+adminMocksPath, both); code != http.StatusBadRequest {
+		t.Errorf("expected mock with response and responses to return 400 found:%v", code)
+	}
+}
+
+func TestInvalidSequenceConfigs(t *testing.T) {
+	invalid := map[string]string{
+		"invalid sequence": `sequence = "shuffle"
+			request {
+				path = "/a"
+				verb = "GET"
+			}
+			response {
+				body = "a"
+			}`,
+		"negative repeat": `request {
+				path = "/a"
+				verb = "GET"
+			}
+			response {
+				body = "a"
+				repeat = -1
+			}`,
+	}
+
+	for name, mock := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\nmock \"m\" {\n" + mock + "\n}\n}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil || !strings.Contains(err.Error(), "mock \"m\"") {
+			t.Errorf("%v: expected config load to fail for mock m found:%v", name, err)
+		}
+	}
+}
+
+const weightedTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+	random_seed = 42
+
+	mock "chaos" {
+		request {
+			path = "/chaos"
+			verb = "GET"
+		}
+		response {
+			body = "ok"
+			weight = 90
+		}
+		response {
+			status = 500
+			body = "boom"
+			weight = 10
+		}
+		response {
+			status = 429
+			body = "slow down"
+			weight = 0
+		}
+	}
+}
+`
+
+func TestWeightedResponses(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(weightedTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	mock := conf.ServerConfig.Mocks[0]
+
+	picks := func() []int {
+		var ss sequenceStore
+		ss.seed(conf.ServerConfig.randomSeed())
+		var out []int
+		for i := 0; i < 1000; i++ {
+			n, _ := ss.next(mock)
+			out = append(out, n)
+		}
+		return out
+	}
+
+	first := picks()
+	counts := make([]int, len(mock.Responses))
+	for _, n := range first {
+		counts[n]++
+	}
+	if counts[0] < 800 || counts[1] < 50 || counts[2] != 0 {
+		t.Errorf("expected roughly 90/10/0 split of responses found:%v", counts)
+	}
+
+	// the same seed gives the same choices
+	second := picks()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same choices for the same seed, call %v differs", i)
+		}
+	}
+}
+
+func TestWeightedResponseRecordedInJournal(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(weightedTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	for i := 0; i < 20; i++ {
+		getBody(t, ts.URL+"/chaos")
+	}
+
+	for _, rl := range ts.Requests(RequestFilter{MockName: "chaos"}) {
+		if rl.ResponseIndex == nil {
+			t.Fatalf("expected response index to be recorded for %v", *rl.RequestUri)
+		}
+		expected := conf.ServerConfig.Mocks[0].Responses[*rl.ResponseIndex].Status
+		if rl.Status != expected {
+			t.Errorf("expected status %v of response %v found:%v", expected, *rl.ResponseIndex, rl.Status)
+		}
+	}
+}
+
+func TestInvalidWeightConfigs(t *testing.T) {
+	invalid := map[string]string{
+		"partial weights": `response {
+				body = "a"
+				weight = 1
+			}
+			response {
+				body = "b"
+			}`,
+		"all zero weights": `response {
+				body = "a"
+				weight = 0
+			}`,
+		"weight with sequence": `sequence = "cycle"
+			response {
+				body = "a"
+				weight = 1
+			}`,
+		"weight with repeat": `response {
+				body = "a"
+				weight = 1
+				repeat = 2
+			}`,
+	}
+
+	for name, responses := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\nmock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n}\n" + responses + "\n}\n}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil || !strings.Contains(err.Error(), "mock \"m\"") {
+			t.Errorf("%v: expected config load to fail for mock m found:%v", name, err)
+		}
+	}
+}
@@ -1,18 +1,27 @@
 package mockaroo
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
 	"time"
 
 	// gorilla seems like the best fit, supports a lot of rich matching
 	// and plays well with native golang http
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 const (
@@ -25,35 +34,208 @@ const (
 //MockServer encapsulates a full mockaroo server
 type MockServer interface {
 	//Start starts the mock server and if the server cannot be started
-	//returns an error
+	//returns an error, Start blocks until the server is shut down
 	Start() error
+
+	//Shutdown gracefully stops the server, in-flight requests are drained
+	//until ctx expires and the request log file is flushed and closed
+	Shutdown(ctx context.Context) error
+
+	//Reload atomically swaps in the mocks of an already validated config, requests
+	//in flight finish with the old mocks; listen address, TLS and request log
+	//settings are only read on Start and need a restart to change
+	Reload(conf *Config) error
+
+	//Requests returns the requests in the journal that match filter, oldest first
+	Requests(filter RequestFilter) []*RequestLog
+
+	//Verify returns an error if the mock with mockName was not matched by
+	//exactly count requests in the journal
+	Verify(mockName string, count int) error
+
+	//ResetRequests clears the request journal
+	ResetRequests()
+
+	//ScenarioStates returns the current state of every scenario used by the mocks
+	ScenarioStates() map[string]string
+
+	//ResetScenarios moves every scenario back to ScenarioStarted
+	ResetScenarios()
+
+	//ResetSequences starts the response sequence of the named mock over,
+	//every mock if mockName is empty
+	ResetSequences(mockName string)
 }
 
 //muxServer users gorilla mux for routing
 type muxServer struct {
-	conf       *Config
-	router     *mux.Router
+	// guards conf, router and grpcServer which are swapped on Reload,
+	// they are first set up in setupRouting
+	routingOnce sync.Once
+	routerMu    sync.RWMutex
+	conf        *Config
+	router      *mux.Router
+	grpcServer  *grpc.Server
+
+	// the admin API router is built once on first use, adminMu
+	// serializes changes made to mocks through the admin API
+	adminOnce   sync.Once
+	adminRouter *mux.Router
+	adminMu     sync.Mutex
+
+	// in memory record of recent requests, set up in prepare
+	journal *journal
+
+	// proxies and records unmatched requests in record mode, set up in prepare
+	recorder *recorder
+
+	// current state of all scenarios, kept across reloads
+	scenarios scenarioStore
+
+	// calls served by mocks with several responses, kept across reloads
+	sequences sequenceStore
+
+	// draws response delays, seeded in prepare
+	delays lockedRand
+
+	// CA and certificates by listener name for listeners with tls auto,
+	// generated in prepare
+	ca        *certAuthority
+	autoCerts map[string]tls.Certificate
+
+	// guards reqLogFile, servers and listeners which are set up in Start
+	// and torn down in Shutdown possibly from another goroutine, there is
+	// a server for every listener in the config, along with the open
+	// websockets and what ends their scripts, no servers are tracked
+	// once shutdown is set
+	mu         sync.Mutex
+	shutdown   bool
 	reqLogFile *os.File
+	servers    []*http.Server
+	listeners  []net.Listener
+	webSockets map[*websocket.Conn]context.CancelFunc
 }
 
-// NewServer creates a mock server with the given configuration
+// NewServer creates a mock server with the given configuration, it can serve
+// requests through ServeHTTP right away without being started
 func NewServer(conf *Config) MockServer {
-	return &muxServer{conf: conf, router: mux.NewRouter()}
+	s := &muxServer{conf: conf}
+	if conf != nil && conf.ServerConfig != nil {
+		s.setupRouting()
+	}
+	return s
 }
 
 func (s *muxServer) getRouter() *mux.Router {
+	s.routerMu.RLock()
+	defer s.routerMu.RUnlock()
 	return s.router
 }
 
+func (s *muxServer) getGRPCServer() *grpc.Server {
+	s.routerMu.RLock()
+	defer s.routerMu.RUnlock()
+	return s.grpcServer
+}
+
+func (s *muxServer) getConf() *Config {
+	s.routerMu.RLock()
+	defer s.routerMu.RUnlock()
+	return s.conf
+}
+
+//ServeHTTP routes the request to the matching mock, this lets the mock server
+//be plugged into anything that takes a http.Handler
+func (s *muxServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// the router is only missing without a server config, the admin API
+	// needs one as much as the mocks do
+	router := s.getRouter()
+	if router == nil {
+		http.Error(w, "mockaroo has no server config to serve requests", http.StatusInternalServerError)
+		return
+	}
+	if isAdminPath(req.URL.Path) {
+		s.getAdminRouter().ServeHTTP(w, req)
+		return
+	}
+	// gRPC calls are logged once the message is decoded, the body
+	// cannot be read up front as calls can be streaming
+	if gs := s.getGRPCServer(); gs != nil && isGRPCRequest(req) {
+		gs.ServeHTTP(w, req)
+		return
+	}
+	s.requestLoggingMiddleware(router).ServeHTTP(w, req)
+}
+
 func (s *muxServer) Start() error {
 
+	// nothing to start once the server has been shut down
+	if s.isShutdown() {
+		log.Info("mockaroo was shut down before it started")
+		return nil
+	}
+
+	if err := s.prepare(); err != nil {
+		return err
+	}
+
+	// listen on every address before serving on any of them
+	listeners := s.getConf().ServerConfig.listeners
+	lns := make([]net.Listener, 0, len(listeners))
+	for _, l := range listeners {
+		ln, err := net.Listen("tcp", *l.ListenAddr)
+		if err != nil {
+			for _, open := range lns {
+				open.Close()
+			}
+			s.closeLogFile()
+			return fmt.Errorf("error listening on %v for listener \"%v\": %w", *l.ListenAddr, l.Name, err)
+		}
+		lns = append(lns, ln)
+	}
+
+	// a Shutdown that came in while starting stops the tracking, the
+	// servers tracked before it are shut down by it and return right away
+	srvs := make([]*http.Server, 0, len(lns))
+	for i, l := range listeners {
+		srv := s.trackServer(l, lns[i])
+		if srv == nil {
+			break
+		}
+		srvs = append(srvs, srv)
+	}
+	for _, ln := range lns[len(srvs):] {
+		ln.Close()
+	}
+	if len(srvs) < len(lns) {
+		log.Info("mockaroo was shut down while starting")
+		s.closeLogFile()
+	}
+
+	errs := make(chan error, len(srvs))
+	for i, srv := range srvs {
+		go func(srv *http.Server, l *Listener, ln net.Listener) {
+			errs <- s.serve(srv, l, ln)
+		}(srv, listeners[i], lns[i])
+	}
+
+	// the first listener to fail takes the others down with it
+	var err error
+	for range srvs {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+			s.closeServers()
+		}
+	}
+	return err
+}
+
+//prepare sets up the request log file and builds the router for all mocks
+func (s *muxServer) prepare() error {
 	if s.conf == nil {
 		return fmt.Errorf("server config is nil cannot start mockaroo")
 	}
 
-	// add all the required routes
-	s.addRoutes()
-
 	lfp := s.conf.ServerConfig.RequestLogPath
 	if lfp != nil {
 		// if logging path is configured setup logging
@@ -61,37 +243,286 @@ func (s *muxServer) Start() error {
 		if err != nil {
 			return fmt.Errorf("error logging to %v: %w", *lfp, err)
 		}
-		s.reqLogFile = lf
-
 		// the request log file will be closed when when the
 		// server shuts down
-		defer lf.Close()
+		s.mu.Lock()
+		s.reqLogFile = lf
+		s.mu.Unlock()
+	}
+
+	if err := s.setupAutoTLS(s.conf.ServerConfig.listeners); err != nil {
+		s.closeLogFile()
+		return err
+	}
+
+	s.setupRouting()
+	return nil
+}
+
+//setupRouting sets up the journal, the recorder and the routers, everything
+//needed to serve requests through ServeHTTP, it runs only once either from
+//NewServer or from prepare
+func (s *muxServer) setupRouting() {
+	s.routingOnce.Do(func() {
+		s.journal = newJournal(s.conf.ServerConfig.journalSize())
+		s.sequences.seed(s.conf.ServerConfig.randomSeed())
+		s.delays.seed(s.conf.ServerConfig.randomSeed())
+
+		if rc := s.conf.ServerConfig.Record; rc != nil {
+			s.recorder = newRecorder(rc, *s.conf.ServerConfig.listeners[0].ListenAddr)
+		}
+
+		// add all the required routes
+		router := s.newRouter(s.conf)
+		gs := s.newGRPCServer(s.conf)
+		s.routerMu.Lock()
+		s.router = router
+		s.grpcServer = gs
+		s.routerMu.Unlock()
+	})
+}
+
+func (s *muxServer) Reload(conf *Config) error {
+	if conf == nil || conf.ServerConfig == nil {
+		return fmt.Errorf("server config is nil cannot reload mockaroo")
 	}
 
-	// add all middlewares
-	s.router.Use(s.requestLoggingMiddleware)
+	// build the router outside the lock so requests are never blocked on it
+	router := s.newRouter(conf)
+	gs := s.newGRPCServer(conf)
+
+	s.routerMu.Lock()
+	old := s.conf
+	s.conf = conf
+	s.router = router
+	s.grpcServer = gs
+	s.routerMu.Unlock()
+
+	if old != nil && old.ServerConfig != nil && !sameStartupSettings(old.ServerConfig, conf.ServerConfig) {
+		log.Warn("listen address, TLS, request log or random seed settings changed, restart mockaroo for them to take effect")
+	}
+	log.Infof("reloaded config with %v mocks", len(conf.ServerConfig.Mocks))
+	return nil
+}
+
+//sameStartupSettings checks if the settings read only on Start are the same
+func sameStartupSettings(a, b *ServerConf) bool {
+	same := func(x, y *string) bool {
+		return (x == nil && y == nil) || (x != nil && y != nil && *x == *y)
+	}
+	if len(a.listeners) != len(b.listeners) {
+		return false
+	}
+	// the mocks a listener serves are read by the router and can change
+	for i, la := range a.listeners {
+		lb := b.listeners[i]
+		if la.Name != lb.Name ||
+			!same(la.ListenAddr, lb.ListenAddr) ||
+			!same(la.SnakeOilCertPath, lb.SnakeOilCertPath) ||
+			!same(la.SnakeOilKeyPath, lb.SnakeOilKeyPath) ||
+			!sameTLS(la.TLS, lb.TLS) ||
+			la.protocol() != lb.protocol() {
+			return false
+		}
+	}
+	return same(a.RequestLogPath, b.RequestLogPath) &&
+		a.randomSeed() == b.randomSeed()
+}
+
+//newRouter builds a fresh router with all the mocks of conf, middlewares and
+//the not found handler, every call returns an independent router
+func (s *muxServer) newRouter(conf *Config) *mux.Router {
+	router := mux.NewRouter()
+	served := mockListeners(conf.ServerConfig.listeners, conf.ServerConfig.Mocks)
+	s.addRoutes(router, conf.ServerConfig.Mocks, served)
+
+	// add the not found handler for logging, requests that only missed
+	// on the verb get a report of the near misses as well
+	diag := s.newDiagnostics(conf.ServerConfig.Mocks, served)
+	router.NotFoundHandler = s.unmatchedHandler(conf, diag)
+	router.MethodNotAllowedHandler = diag.handler(http.StatusMethodNotAllowed, "method not allowed")
+	if dm := conf.ServerConfig.defaultMock; dm != nil && s.recorder == nil {
+		router.MethodNotAllowedHandler = s.defaultHandler(dm, diag)
+	}
+	// a request that only missed on the verb did not match a mock either,
+	// in record mode it is recorded and otherwise forwarded if a fallback
+	// is set
+	if s.recorder != nil || conf.ServerConfig.proxyFallbackURL != nil {
+		router.MethodNotAllowedHandler = router.NotFoundHandler
+	}
+
+	return router
+}
 
-	// add the not found handler for logging
-	s.router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		log.Warnf("request path :%v lead to 404", req.RequestURI)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "request not found",
+//unmatchedHandler picks the handler for requests that do not match any mock
+func (s *muxServer) unmatchedHandler(conf *Config, diag *diagnostics) http.Handler {
+	// in record mode everything unmatched goes to the upstream
+	if s.recorder != nil {
+		return s.recorder
+	}
+
+	if u := conf.ServerConfig.proxyFallbackURL; u != nil {
+		proxy := newReverseProxy(u)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			log.Infof("request path :%v did not match forwarding to %v", req.RequestURI, u)
+			proxy.ServeHTTP(w, req)
 		})
+	}
+
+	if dm := conf.ServerConfig.defaultMock; dm != nil {
+		return s.defaultHandler(dm, diag)
+	}
+
+	return diag.handler(http.StatusNotFound, "request not found")
+}
+
+//defaultHandler answers requests no mock matched with the configured
+//default response, the near misses still go in the request log
+func (s *muxServer) defaultHandler(dm *Mock, diag *diagnostics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		log.Warnf("request path :%v did not match sending the default response", req.RequestURI)
+		if rl := requestLogFromContext(req.Context()); rl != nil {
+			rl.NearMisses = diag.nearMisses(req)
+		}
+		s.writeResponse(w, req, dm, dm.Response, nil)
 	})
+}
+
+//trackServer creates the http.Server for listener l on ln and remembers it so
+//that a Shutdown from any goroutine can stop it, every server gets its own
+//http.Server so it can be shut down independently of anything else
+//registered in the process, requests carry the name of l in their context,
+//nil is returned once the server is shut down
+func (s *muxServer) trackServer(l *Listener, ln net.Listener) *http.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		return nil
+	}
+	srv := &http.Server{
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), listenerKey, l.Name)
+		},
+	}
+	if l.TLS != nil {
+		srv.TLSConfig = l.TLS.config.Clone()
+		if cert, present := s.autoCerts[l.Name]; present {
+			srv.TLSConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	configureProtocol(srv, l, s)
+	s.servers = append(s.servers, srv)
+	s.listeners = append(s.listeners, ln)
+	return srv
+}
 
-	// let the router handle all the requests
-	http.Handle("/", s.router)
+//serve blocks serving requests of listener l on ln until the server is shut down
+func (s *muxServer) serve(srv *http.Server, l *Listener, ln net.Listener) error {
+	var err error
 
 	// start the server
 	// if the server fails to start it will return an error
-	if s.conf.ServerConfig.Mode == HTTPS {
-		return http.ListenAndServeTLS(*s.conf.ServerConfig.ListenAddr,
-			*s.conf.ServerConfig.SnakeOilCertPath,
-			*s.conf.ServerConfig.SnakeOilKeyPath, nil)
+	switch {
+	case l.Mode == HTTPS && l.TLS != nil && l.TLS.Auto:
+		// the generated certificate is in the TLS config already
+		err = srv.ServeTLS(ln, "", "")
+	case l.Mode == HTTPS:
+		err = srv.ServeTLS(ln, *l.SnakeOilCertPath, *l.SnakeOilKeyPath)
+	default:
+		err = srv.Serve(ln)
+	}
+
+	// a graceful shutdown is not an error
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	s.closeLogFile()
+	return err
+}
+
+func (s *muxServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	servers := append([]*http.Server{}, s.servers...)
+	s.mu.Unlock()
+
+	// server was never started there is nothing to drain
+	if len(servers) == 0 {
+		s.closeLogFile()
+		return nil
 	}
-	return http.ListenAndServe(*s.conf.ServerConfig.ListenAddr, nil)
+
+	// websockets are hijacked so the servers do not wait for them
+	s.closeWebSockets()
+
+	// all listeners drain at the same time
+	log.Info("shutting down mockaroo, draining in-flight requests...")
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}(i, srv)
+	}
+	wg.Wait()
+
+	var err error
+	for _, e := range errs {
+		if e != nil {
+			err = e
+			break
+		}
+	}
+
+	// all requests have been drained or ctx expired, either way no more
+	// requests will be logged so flush the log file
+	s.closeLogFile()
+	return err
+}
+
+//isShutdown checks if Shutdown has been called
+func (s *muxServer) isShutdown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shutdown
+}
+
+//closeServers stops every server right away without draining requests
+func (s *muxServer) closeServers() {
+	s.closeWebSockets()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, srv := range s.servers {
+		srv.Close()
+	}
+}
+
+// addr returns the address the first listener is listening on or nil
+// if the server has not started listening yet
+func (s *muxServer) addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.listeners) == 0 {
+		return nil
+	}
+	return s.listeners[0].Addr()
+}
+
+func (s *muxServer) closeLogFile() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reqLogFile == nil {
+		return
+	}
+	if err := s.reqLogFile.Sync(); err != nil {
+		log.Warnf("error flushing request log:%v", err)
+	}
+	if err := s.reqLogFile.Close(); err != nil {
+		log.Warnf("error closing request log:%v", err)
+	}
+	s.reqLogFile = nil
 }
 
 type RequestLog struct {
@@ -102,6 +533,30 @@ type RequestLog struct {
 	ContentLength int64       `json:"content_length"`
 	RemoteAddr    *string     `json:"remote_addr"`
 	QueryValues   *url.Values `json:"query_params"`
+	Path          *string     `json:"path"`
+
+	// name of the listener the request came in on if any
+	Listener string `json:"listener,omitempty"`
+
+	// certificate the client presented in the TLS handshake if any
+	ClientCert *PeerCert `json:"client_cert,omitempty"`
+
+	// filled in once the request has been handled
+	MockName *string `json:"mock,omitempty"`
+	Body     string  `json:"body,omitempty"`
+	Status   int     `json:"status"`
+
+	// status code of a gRPC call as named by grpc-go e.g. OK or NotFound
+	GRPCStatus string `json:"grpc_status,omitempty"`
+
+	// index of the response served by a mock with several responses
+	ResponseIndex *int `json:"response_index,omitempty"`
+
+	// fault injected into the response if any
+	Fault *string `json:"fault,omitempty"`
+
+	// mocks that came closest to matching a request no mock matched
+	NearMisses []*NearMiss `json:"near_misses,omitempty"`
 }
 
 // take a http request and convert it into loggable entry
@@ -109,6 +564,7 @@ func requestLogFromRequest(r *http.Request) *RequestLog {
 	q := r.URL.Query()
 	t := time.Now().UTC()
 	pt := &t
+	listener, _ := listenerFromContext(r.Context())
 	return &RequestLog{
 		RequestUri:    &r.RequestURI,
 		Timestamp:     pt,
@@ -117,6 +573,9 @@ func requestLogFromRequest(r *http.Request) *RequestLog {
 		ContentLength: r.ContentLength,
 		RemoteAddr:    &r.RemoteAddr,
 		QueryValues:   &q,
+		Path:          &r.URL.Path,
+		Listener:      listener,
+		ClientCert:    peerCert(r),
 	}
 }
 
@@ -130,25 +589,136 @@ func (s *muxServer) setupLogFile() (*os.File, error) {
 	return lf, nil
 }
 
-// log all requests to STDOUT and specified log file if configured
+// log all requests to the journal and specified log file if configured
 func (s *muxServer) requestLoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		// TODO: add error handling here
-		rl, _ := json.Marshal(requestLogFromRequest(r))
+		rl := requestLogFromRequest(r)
 
-		if s.reqLogFile != nil {
-			fmt.Fprintf(s.reqLogFile, "%s\n", rl)
+		// keep the body for the log and hand a fresh reader to the handlers
+		if r.Body != nil {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				log.Warnf("error reading body of request:%v error:%v", r.RequestURI, err)
+			}
+			r.Body.Close()
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			rl.Body = string(body)
 		}
 
-		// call next handler
-		next.ServeHTTP(w, r)
+		// the request is logged even when a fault aborts the handler
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			rl.Status = sw.status
+			s.logRequest(rl)
+		}()
+
+		// call next handler, the mock handler fills in the matched mock
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestLogKey, rl)))
 	})
 }
 
-func (s *muxServer) addRoutes() {
-	for _, m := range s.conf.ServerConfig.Mocks {
-		r := s.router.HandleFunc(m.Request.NormalizedPath, genHandleFunc(m)).Methods(*m.Request.Verb)
+//logRequest adds rl to the journal and the request log file if configured
+func (s *muxServer) logRequest(rl *RequestLog) {
+	s.journal.add(rl)
+
+	// TODO: add error handling here
+	line, _ := json.Marshal(rl)
+
+	// the log file could be closed by a concurrent Shutdown
+	s.mu.Lock()
+	if s.reqLogFile != nil {
+		fmt.Fprintf(s.reqLogFile, "%s\n", line)
+	}
+	s.mu.Unlock()
+}
+
+//statusWriter remembers the status code written to the response
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+//Hijack hands the connection over to fault injection, no status is
+//recorded for hijacked connections
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	w.status = 0
+	w.wroteHeader = true
+	return hj.Hijack()
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//mockRoute is a standalone route with the path and query matchers of mock
+//as addRoutes sets them up, used to check mux takes them
+func mockRoute(mock *Mock) *mux.Route {
+	r := new(mux.Route)
+	if mock.Request.PathPrefix {
+		r.PathPrefix(mock.Request.NormalizedPath)
+	} else {
+		r.Path(mock.Request.NormalizedPath)
+	}
+	for k, v := range mock.Request.Queries {
+		r.Queries(k, v)
+	}
+	return r
+}
+
+//addRoutes adds a route for every mock, gorilla tries routes in the order
+//they are added so mocks go in by priority and specificity, mocks in served
+//only match requests on the listeners that serve them
+func (s *muxServer) addRoutes(router *mux.Router, mocks []*Mock, served map[string]map[string]bool) {
+	for _, m := range sortMocks(mocks) {
+		// paths ending in "**" match everything below them
+		var r *mux.Route
+		if m.Request.PathPrefix {
+			r = router.PathPrefix(m.Request.NormalizedPath).HandlerFunc(s.genHandleFunc(m))
+		} else {
+			r = router.HandleFunc(m.Request.NormalizedPath, s.genHandleFunc(m))
+		}
+		r.Methods(*m.Request.Verb)
+
+		if names, ok := served[m.Name]; ok {
+			r.MatcherFunc(listenerMatcher(names))
+		}
+
+		if m.Request.Host != nil {
+			r.Host(hostTemplate(*m.Request.Host))
+		}
+		if m.Request.Scheme != nil {
+			r.Schemes(*m.Request.Scheme)
+		}
+		if len(m.Request.clientNets) > 0 {
+			r.MatcherFunc(clientCIDRMatcher(m.Request.clientNets))
+		}
+		if m.Request.ClientCert != nil {
+			r.MatcherFunc(clientCertMatcher(m.Request.ClientCert))
+		}
+		if m.Request.Protocol != nil {
+			r.MatcherFunc(protocolMatcher(*m.Request.Protocol))
+		}
 
 		// if headers are present add them to the route
 		if m.Request.Headers != nil {
@@ -163,57 +733,107 @@ func (s *muxServer) addRoutes() {
 				r.Queries(k, v)
 			}
 		}
+
+		// the body is matched last as it has to be read
+		if len(m.Request.Form) > 0 || len(m.Request.Files) > 0 {
+			r.MatcherFunc(formMatcher(m.Request.Form, m.Request.Files))
+		}
+		if m.Request.Body != nil {
+			r.MatcherFunc(bodyMatcher(m.Request.Body))
+		}
+
+		// the mock only matches in a specific scenario state
+		if m.Scenario != nil && m.Scenario.State != nil {
+			r.MatcherFunc(s.scenarios.scenarioMatcher(m.Scenario))
+		}
 	}
 }
 
 // generate the handle function for each mock
-func genHandleFunc(mock *Mock) func(http.ResponseWriter, *http.Request) {
+func (s *muxServer) genHandleFunc(mock *Mock) func(http.ResponseWriter, *http.Request) {
 	return func(resp http.ResponseWriter, req *http.Request) {
 
 		log.Infof("request matched mock:\"%v\" with path:\"%v\"", mock.Name, *mock.Request.Path)
-
-		// parse form if needed
-		err := req.ParseForm()
-		if err != nil {
-			resp.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(resp, "parsing form data failed error:%v", err)
+		if rl := requestLogFromContext(req.Context()); rl != nil {
+			rl.MockName = &mock.Name
 		}
 
-		// delay if we need to
-		if mock.Response.Delay != nil {
-			randomDelay := int64(0)
-			if mock.Response.Delay.MaxMillis-mock.Response.Delay.MinMillis > 0 {
-				randomDelay = mock.Response.Delay.MaxMillis - mock.Response.Delay.MinMillis
-			}
-			sleepFor := mock.Response.Delay.MinMillis + randomDelay
-			time.Sleep(time.Duration(sleepFor) * time.Millisecond)
-		}
+		// move the scenario along once the response is out
+		defer s.scenarios.transition(mock.Scenario)
 
-		for key, val := range mock.Response.Headers {
-			resp.Header().Add(key, val)
+		// pick the response for this call when the mock has several
+		i, response := s.sequences.next(mock)
+		if rl := requestLogFromContext(req.Context()); rl != nil && len(mock.Responses) > 1 {
+			rl.ResponseIndex = &i
 		}
 
-		// write the status
-		resp.WriteHeader(mock.Response.Status)
+		// the server wide delay applies to mocks without one
+		s.writeResponse(resp, req, mock, response, s.getConf().ServerConfig.Delay)
+	}
+}
 
-		switch {
-		case mock.Response.Template != nil:
-			// TODO: pass all context data here
-			err := mock.Response.Template.Execute(resp, NewTemplateContext(req))
-			if err != nil {
-				// raise a 500
-				errMsg := fmt.Sprintf("template execution failed for mock \"%v\" error:%v", mock.Name, err.Error())
-				log.Errorf("%s", errMsg)
-				resp.WriteHeader(http.StatusInternalServerError)
-				fmt.Fprint(resp, errMsg)
-			}
-		case mock.Response.Content != nil:
-			fmt.Fprintf(resp, "%s", mock.Response.Content)
-		default:
-			// we should never be here if we are here mockaroo bunged it
-			// please open an issue
+//writeResponse delays and writes out response of mock, defaultDelay is used
+//if the response has no delay of its own
+func (s *muxServer) writeResponse(resp http.ResponseWriter, req *http.Request, mock *Mock, response *Response, defaultDelay *Delay) {
+	// delay if we need to
+	delay := response.Delay
+	if delay == nil {
+		delay = defaultDelay
+	}
+	if delay != nil {
+		time.Sleep(delay.sample(&s.delays))
+	}
+
+	// the response comes from the upstream, the body has to be
+	// forwarded untouched so this goes before parsing forms
+	if response.Proxy != nil {
+		response.Proxy.proxy.ServeHTTP(resp, req)
+		return
+	}
+
+	// parse form if needed
+	err := req.ParseForm()
+	if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(resp, "parsing form data failed error:%v", err)
+	}
+
+	// the script takes over the connection once it is upgraded
+	if response.WebSocket != nil {
+		s.serveWebSocket(resp, req, mock, response)
+		return
+	}
+
+	for key, val := range response.Headers {
+		resp.Header().Add(key, val)
+	}
+
+	// faults take over writing the response
+	if response.Fault != nil {
+		s.serveFault(resp, req, mock, response)
+		return
+	}
+
+	// write the status
+	resp.WriteHeader(response.Status)
+
+	switch {
+	case response.Template != nil:
+		// TODO: pass all context data here
+		err := response.Template.Execute(resp, NewTemplateContext(req))
+		if err != nil {
+			// raise a 500
+			errMsg := fmt.Sprintf("template execution failed for mock \"%v\" error:%v", mock.Name, err.Error())
+			log.Errorf("%s", errMsg)
 			resp.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(resp, "BAD BAD BAD mockaroo fix your test cases; mock \"%v\"", mock.Name)
+			fmt.Fprint(resp, errMsg)
 		}
+	case response.Content != nil:
+		fmt.Fprintf(resp, "%s", response.Content)
+	default:
+		// we should never be here if we are here mockaroo bunged it
+		// please open an issue
+		resp.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(resp, "BAD BAD BAD mockaroo fix your test cases; mock \"%v\"", mock.Name)
 	}
 }
@@ -1,13 +1,15 @@
 package mockaroo
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
-
-	"github.com/gorilla/mux"
 )
 
 func TestBasicMockWorksCorrectly(t *testing.T) {
@@ -263,6 +265,222 @@ func TestRequestLogFromRequestWorksCorrectly(t *testing.T) {
 	}
 }
 
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	lf, err := ioutil.TempFile("", "request_log*.log")
+	if err != nil {
+		t.Fatalf("could not create temp request log file")
+	}
+	lf.Close()
+	defer os.Remove(lf.Name())
+
+	sampleConfig := fmt.Sprintf(`
+	server {
+		listen_addr = "localhost:0"
+		request_log_path = "%s"
+		mock "slow" {
+			request {
+				path = "/slow"
+				verb = "GET"
+			}
+			response {
+				body = "done"
+				delay {
+					min_millis = 300
+					max_millis = 300
+				}
+			}
+		}
+	}
+	`, lf.Name())
+	configHarness(t, sampleConfig, func(configPath string) {
+		conf, err := LoadConfig(&configPath)
+		if err != nil {
+			t.Fatalf("config load failed with error:%v>\n%s", err.Error(), sampleConfig)
+		}
+
+		s := NewServer(conf).(*muxServer)
+		started := make(chan error, 1)
+		go func() {
+			started <- s.Start()
+		}()
+		addr := waitForAddr(t, s)
+
+		// fire a slow request and shut the server down while it is in flight
+		responses := make(chan *http.Response, 1)
+		go func() {
+			resp, err := http.Get(fmt.Sprintf("http://%s/slow", addr))
+			if err != nil {
+				t.Errorf("in-flight request failed with error:%v", err)
+			}
+			responses <- resp
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			t.Errorf("expected clean shutdown but found error:%v", err)
+		}
+
+		if err := <-started; err != nil {
+			t.Errorf("expected Start to return nil after shutdown but found:%v", err)
+		}
+
+		resp := <-responses
+		if resp == nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected in-flight request to complete with 200 but found:%v", resp)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if strings.TrimSpace(string(body)) != "done" {
+			t.Errorf("expected response body:done but found:%s", body)
+		}
+
+		logged, _ := ioutil.ReadFile(lf.Name())
+		if !strings.Contains(string(logged), "/slow") {
+			t.Errorf("expected request log to contain /slow but found:%s", logged)
+		}
+
+		// new connections should be refused once the server is down
+		if _, err := http.Get(fmt.Sprintf("http://%s/slow", addr)); err == nil {
+			t.Errorf("expected request after shutdown to fail")
+		}
+	})
+}
+
+func TestShutdownBeforeStartIsNoop(t *testing.T) {
+	s := NewServer(&Config{})
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected shutdown of server that never started to succeed but found:%v", err)
+	}
+}
+
+func TestHandlerServesWithoutStart(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(shutdownTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	s := NewServer(conf)
+	handler, ok := s.(http.Handler)
+	if !ok {
+		t.Fatalf("expected the server to be an http.Handler")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("expected 200 hello found:%v %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unmocked path found:%v", rec.Code)
+	}
+
+	if reqs := s.(*muxServer).Requests(RequestFilter{MockName: "hello"}); len(reqs) != 1 {
+		t.Errorf("expected the journal to record 1 request found:%+v", reqs)
+	}
+
+	// a server without a config answers with an error instead of panicking
+	rec = httptest.NewRecorder()
+	NewServer(&Config{}).(http.Handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 without a server config found:%v", rec.Code)
+	}
+}
+
+func TestStartAfterShutdownDoesNotServe(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(shutdownTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	s := NewServer(conf).(*muxServer)
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected shutdown to succeed but found:%v", err)
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		started <- s.Start()
+	}()
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Errorf("expected Start after Shutdown to return nil but found:%v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected Start after Shutdown to return right away")
+	}
+	if addr := s.addr(); addr != nil {
+		t.Errorf("expected no listener after Shutdown but found:%v", addr)
+	}
+}
+
+func TestShutdownWhileStarting(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(shutdownTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+
+	// shut down at different points of starting up, Start always returns
+	for i := 0; i < 20; i++ {
+		s := NewServer(conf).(*muxServer)
+		started := make(chan error, 1)
+		go func() {
+			started <- s.Start()
+		}()
+		time.Sleep(time.Duration(i) * time.Millisecond / 4)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := s.Shutdown(ctx); err != nil {
+			t.Errorf("expected clean shutdown but found error:%v", err)
+		}
+		cancel()
+
+		select {
+		case err := <-started:
+			if err != nil {
+				t.Errorf("expected Start to return nil after shutdown but found:%v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Start did not return after Shutdown")
+		}
+
+		if addr := s.addr(); addr != nil {
+			if _, err := http.Get(fmt.Sprintf("http://%s/hello", addr)); err == nil {
+				t.Errorf("expected request after shutdown to fail")
+			}
+		}
+	}
+}
+
+const shutdownTestConfig = `
+server {
+	listen_addr = "localhost:0"
+	mock "hello" {
+		request {
+			path = "/hello"
+			verb = "GET"
+		}
+		response {
+			body = "hello"
+		}
+	}
+}
+`
+
+func waitForAddr(t *testing.T, s *muxServer) string {
+	for i := 0; i < 100; i++ {
+		if addr := s.addr(); addr != nil {
+			return addr.String()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server did not start listening in time")
+	return ""
+}
+
 func createGetRequest(t *testing.T, query string, headers map[string]string) *http.Request {
 	req, err := http.NewRequest("GET", query, nil)
 	if err != nil {
@@ -282,9 +500,9 @@ func loadConfigAndGetServer(t *testing.T, configPath, sampleConfig string) *muxS
 	}
 
 	// make new server with config
-	muxServer := &muxServer{conf: conf, router: mux.NewRouter()}
+	muxServer := &muxServer{conf: conf}
 
 	// add all routes
-	muxServer.addRoutes()
+	muxServer.router = muxServer.newRouter(conf)
 	return muxServer
 }
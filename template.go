@@ -44,6 +44,12 @@ type TemplateContext struct {
 	//PathVars is the path variables captured as a part of the path
 	PathVars map[string]string
 
+	//Files are the files uploaded in a multipart/form-data request
+	Files []*UploadedFile
+
+	//ClientCert is the certificate the client presented over HTTPS, nil if none
+	ClientCert *PeerCert
+
 	//Fake contains the context to fake data from "github.com/brianvoe/gofakeit"
 	Fake *fakeit.Faker
 
@@ -70,6 +76,16 @@ func (tc *TemplateContext) PathVariable(key string) string {
 	return ""
 }
 
+//File returns the first file uploaded under field, an empty file if there is none
+func (tc *TemplateContext) File(field string) *UploadedFile {
+	for _, f := range tc.Files {
+		if f.Field == field {
+			return f
+		}
+	}
+	return &UploadedFile{}
+}
+
 //RandomInt generates a new pseudo random int between min and max seeded by the same constance value
 func (tc *TemplateContext) RandomInt(min, max int) int {
 	return min + stableRandom.Intn(max-min)
@@ -83,6 +99,18 @@ func (tc *TemplateContext) RandomFloat(min, max float32) float32 {
 //NewTemplateContext returns a pointer to TemplateContext
 func NewTemplateContext(req *http.Request) *TemplateContext {
 
+	// ParseForm leaves out multipart fields, they go along with the rest of the form
+	form := req.Form
+	values, files := parseFormBody(req)
+	for k, v := range values {
+		if form == nil {
+			form = make(url.Values)
+		}
+		if _, present := form[k]; !present {
+			form[k] = v
+		}
+	}
+
 	// if the request body is non nil try to coerce it into JSON
 	var jsonBody map[string]interface{}
 	if req.Body != nil {
@@ -98,9 +126,11 @@ func NewTemplateContext(req *http.Request) *TemplateContext {
 		Host:       &req.Host,
 		RemoteAddr: &req.RemoteAddr,
 		Headers:    req.Header,
-		Form:       req.Form,
+		Form:       form,
 		JsonBody:   jsonBody,
 		PathVars:   pathVarsOrEmpty(req),
+		Files:      files,
+		ClientCert: peerCert(req),
 		Fake:       stableFake,
 		uuid:       make([]byte, 16), // 16 bytes for UUID
 	}
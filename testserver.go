@@ -0,0 +1,112 @@
+package mockaroo
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// time given to in-flight requests to drain when a test finishes
+	testServerShutdownTimeout = 5 * time.Second
+)
+
+//TestServer is a mockaroo server running in process on an ephemeral local
+//port, much like httptest.Server, meant to be used from go tests without
+//spawning the mockaroo binary
+type TestServer struct {
+	MockServer
+
+	//URL is the base URL of the first listener of the form
+	//http://127.0.0.1:<port> with no trailing slash
+	URL string
+
+	//Listener is the first listener the server is serving requests on
+	Listener net.Listener
+
+	//URLs are the base URLs of all listeners by listener name, the
+	//listen_addr at the top of the server block is named "default"
+	URLs map[string]string
+
+	server *muxServer
+}
+
+//Client returns a HTTP client that trusts the CA of the certificates
+//generated for listeners with tls auto
+func (ts *TestServer) Client() *http.Client {
+	if ts.server.ca == nil {
+		return &http.Client{}
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.server.ca.cert)
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+}
+
+//NewTestServer starts a mockaroo server for the given configuration with every
+//listener on an ephemeral port of the loopback interface, the listen addresses
+//of the config are ignored, the server is shut down automatically when the
+//test and all its sub tests complete
+func NewTestServer(t testing.TB, conf *Config) *TestServer {
+	t.Helper()
+
+	if conf == nil || conf.ServerConfig == nil {
+		t.Fatalf("mockaroo: server config is nil cannot start test server")
+	}
+
+	s := &muxServer{conf: conf}
+	if err := s.prepare(); err != nil {
+		t.Fatalf("mockaroo: error preparing test server: %v", err)
+	}
+
+	ts := &TestServer{MockServer: s, URLs: make(map[string]string), server: s}
+
+	// shut down whatever started even if a later listener fails
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testServerShutdownTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			t.Logf("mockaroo: error shutting down test server: %v", err)
+		}
+	})
+
+	for _, l := range conf.ServerConfig.listeners {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			s.closeLogFile()
+			t.Fatalf("mockaroo: error listening on ephemeral port: %v", err)
+		}
+
+		// track the server before serving so that a cleanup racing with the
+		// serving goroutine still shuts it down
+		srv := s.trackServer(l, ln)
+		if srv == nil {
+			ln.Close()
+			t.Fatalf("mockaroo: test server was shut down while starting")
+		}
+		go func(l *Listener, ln net.Listener) {
+			if err := s.serve(srv, l, ln); err != nil {
+				// not using t here as the test might have completed already
+				log.Errorf("mockaroo: test server stopped with error: %v", err)
+			}
+		}(l, ln)
+
+		scheme := "http"
+		if l.Mode == HTTPS {
+			scheme = "https"
+		}
+		ts.URLs[l.Name] = fmt.Sprintf("%s://%s", scheme, ln.Addr().String())
+		if ts.Listener == nil {
+			ts.URL = ts.URLs[l.Name]
+			ts.Listener = ln
+		}
+	}
+
+	return ts
+}
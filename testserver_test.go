@@ -0,0 +1,99 @@
+package mockaroo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMultipleTestServersInOneBinary(t *testing.T) {
+	confTemplate := `
+	server {
+		listen_addr = "localhost:5000"
+		mock "hello_world" {
+			request {
+				path = "/hello"
+				verb = "GET"
+			}
+			response {
+				body = "%s"
+			}
+		}
+	}
+	`
+
+	var urls []string
+	for _, body := range []string{"first", "second"} {
+		sampleConfig := fmt.Sprintf(confTemplate, body)
+		configHarness(t, sampleConfig, func(configPath string) {
+			conf, err := LoadConfig(&configPath)
+			if err != nil {
+				t.Fatalf("config load failed with error:%v>\n%s", err.Error(), sampleConfig)
+			}
+			ts := NewTestServer(t, conf)
+			if !strings.HasPrefix(ts.URL, "http://127.0.0.1:") {
+				t.Errorf("expected test server URL on loopback but found:%v", ts.URL)
+			}
+			urls = append(urls, ts.URL)
+		})
+	}
+
+	for i, expected := range []string{"first", "second"} {
+		resp, err := http.Get(urls[i] + "/hello")
+		if err != nil {
+			t.Fatalf("request to test server failed with error:%v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected 200 but HTTP request failed with:%v", resp.StatusCode)
+		}
+
+		if strings.TrimSpace(string(body)) != expected {
+			t.Errorf("expected response body:%v but found:%s", expected, body)
+		}
+	}
+}
+
+func TestTestServerShutsDownOnCleanup(t *testing.T) {
+	sampleConfig := `
+	server {
+		listen_addr = "localhost:5000"
+		mock "hello_world" {
+			request {
+				path = "/hello"
+				verb = "GET"
+			}
+			response {
+				body = "world"
+			}
+		}
+	}
+	`
+	var url string
+	configHarness(t, sampleConfig, func(configPath string) {
+		conf, err := LoadConfig(&configPath)
+		if err != nil {
+			t.Fatalf("config load failed with error:%v>\n%s", err.Error(), sampleConfig)
+		}
+
+		// cleanup of the sub test shuts down the server
+		t.Run("serve", func(t *testing.T) {
+			ts := NewTestServer(t, conf)
+			url = ts.URL
+
+			resp, err := http.Get(url + "/hello")
+			if err != nil {
+				t.Fatalf("request to test server failed with error:%v", err)
+			}
+			resp.Body.Close()
+		})
+	})
+
+	if _, err := http.Get(url + "/hello"); err == nil {
+		t.Errorf("expected request to fail after test server cleanup")
+	}
+}
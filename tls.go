@@ -0,0 +1,252 @@
+package mockaroo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+var validClientAuths = map[string]struct{}{
+	ClientAuthNone:    {},
+	ClientAuthRequest: {},
+	ClientAuthRequire: {},
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+//TLSConf holds the TLS settings of a listener served over HTTPS
+type TLSConf struct {
+	Auto         bool     `hcl:"auto,optional"`          // serve a certificate generated at startup
+	Hosts        []string `hcl:"hosts,optional"`         // DNS names and IPs the generated certificate is for
+	CAOut        *string  `hcl:"ca_out"`                 // file the PEM of the CA of the generated certificate is written to
+	ClientCA     *string  `hcl:"client_ca"`              // PEM file of the CAs client certificates are verified against
+	ClientAuth   *string  `hcl:"client_auth"`            // none, request or require
+	MinVersion   *string  `hcl:"min_version"`            // 1.0, 1.1, 1.2 or 1.3
+	CipherSuites []string `hcl:"cipher_suites,optional"` // names as in crypto/tls e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+
+	config *tls.Config
+}
+
+//ClientCertMatcher matches the certificate a client presented in the TLS handshake
+type ClientCertMatcher struct {
+	Subject *string `hcl:"subject" json:"subject,omitempty"` // regexp on the subject e.g. "CN=alice,O=Acme"
+	SAN     *string `hcl:"san" json:"san,omitempty"`         // regexp any DNS, IP, email or URI SAN should match
+
+	subject *regexp.Regexp
+	san     *regexp.Regexp
+}
+
+//PeerCert is the certificate a client presented in the TLS handshake
+type PeerCert struct {
+	Subject      string    `json:"subject"`
+	CommonName   string    `json:"common_name"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	SANs         []string  `json:"sans,omitempty"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+}
+
+//validateTLS checks the tls block of owner and builds the tls.Config
+//the listener is served with
+func validateTLS(fp, owner string, tc *TLSConf) error {
+	config := &tls.Config{}
+
+	if !tc.Auto && (len(tc.Hosts) > 0 || tc.CAOut != nil) {
+		errMsg := fmt.Sprintf("hosts and ca_out are only used with auto = true for %s", owner)
+		return invalidConfErr(fp, errMsg)
+	}
+	for _, h := range tc.Hosts {
+		if strings.TrimSpace(h) == "" {
+			errMsg := fmt.Sprintf("tls hosts cannot have \"\" for %s", owner)
+			return invalidConfErr(fp, errMsg)
+		}
+	}
+	if tc.CAOut != nil && strings.TrimSpace(*tc.CAOut) == "" {
+		errMsg := fmt.Sprintf("tls ca_out cannot be \"\" for %s", owner)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	auth := ClientAuthNone
+	if tc.ClientCA != nil {
+		// a client CA is configured to verify client certificates
+		auth = ClientAuthRequire
+	}
+	if tc.ClientAuth != nil {
+		auth = *tc.ClientAuth
+	}
+	if _, present := validClientAuths[auth]; !present {
+		errMsg := fmt.Sprintf("invalid client_auth \"%s\" for %s client_auth can only be (none|request|require)", auth, owner)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	if tc.ClientCA != nil {
+		pem, err := ioutil.ReadFile(*tc.ClientCA)
+		if err != nil {
+			errMsg := fmt.Sprintf("cannot read client_ca \"%s\" for %s error:%v", *tc.ClientCA, owner, err)
+			return invalidConfErr(fp, errMsg)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			errMsg := fmt.Sprintf("no PEM certificates found in client_ca \"%s\" for %s", *tc.ClientCA, owner)
+			return invalidConfErr(fp, errMsg)
+		}
+		config.ClientCAs = pool
+	}
+
+	// without a CA any certificate is taken as it is
+	switch {
+	case auth == ClientAuthRequest && tc.ClientCA != nil:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case auth == ClientAuthRequest:
+		config.ClientAuth = tls.RequestClientCert
+	case auth == ClientAuthRequire && tc.ClientCA != nil:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	case auth == ClientAuthRequire:
+		config.ClientAuth = tls.RequireAnyClientCert
+	}
+
+	if tc.MinVersion != nil {
+		v, present := tlsVersions[*tc.MinVersion]
+		if !present {
+			errMsg := fmt.Sprintf("invalid min_version \"%s\" for %s min_version can only be (1.0|1.1|1.2|1.3)", *tc.MinVersion, owner)
+			return invalidConfErr(fp, errMsg)
+		}
+		config.MinVersion = v
+	}
+
+	if len(tc.CipherSuites) > 0 {
+		ids := make(map[string]uint16)
+		for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			ids[cs.Name] = cs.ID
+		}
+		for _, name := range tc.CipherSuites {
+			id, present := ids[name]
+			if !present {
+				errMsg := fmt.Sprintf("unknown cipher suite \"%s\" for %s", name, owner)
+				return invalidConfErr(fp, errMsg)
+			}
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+
+	tc.config = config
+	return nil
+}
+
+//sameTLS checks if two tls blocks have the same settings
+func sameTLS(a, b *TLSConf) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	same := func(x, y *string) bool {
+		return (x == nil && y == nil) || (x != nil && y != nil && *x == *y)
+	}
+	return a.Auto == b.Auto &&
+		reflect.DeepEqual(a.Hosts, b.Hosts) &&
+		same(a.CAOut, b.CAOut) &&
+		same(a.ClientCA, b.ClientCA) &&
+		same(a.ClientAuth, b.ClientAuth) &&
+		same(a.MinVersion, b.MinVersion) &&
+		reflect.DeepEqual(a.CipherSuites, b.CipherSuites)
+}
+
+//validateClientCertMatcher compiles the client certificate matcher of mock
+func validateClientCertMatcher(fp string, mock *Mock) error {
+	cm := mock.Request.ClientCert
+	if cm == nil {
+		return nil
+	}
+
+	if cm.Subject == nil && cm.SAN == nil {
+		errMsg := fmt.Sprintf("client_cert needs subject or san for mock \"%s\"", mock.Name)
+		return invalidConfErr(fp, errMsg)
+	}
+
+	compile := func(field string, expr *string) (*regexp.Regexp, error) {
+		if expr == nil {
+			return nil, nil
+		}
+		re, err := regexp.Compile(*expr)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid client_cert %s regexp \"%s\" for mock \"%s\" error:%v", field, *expr, mock.Name, err)
+			return nil, invalidConfErr(fp, errMsg)
+		}
+		return re, nil
+	}
+
+	var err error
+	if cm.subject, err = compile("subject", cm.Subject); err != nil {
+		return err
+	}
+	cm.san, err = compile("san", cm.SAN)
+	return err
+}
+
+//clientCertMatcher matches requests whose client certificate matches cm
+func clientCertMatcher(cm *ClientCertMatcher) mux.MatcherFunc {
+	return func(req *http.Request, rm *mux.RouteMatch) bool {
+		pc := peerCert(req)
+		if pc == nil {
+			return false
+		}
+		if cm.subject != nil && !cm.subject.MatchString(pc.Subject) {
+			return false
+		}
+		if cm.san == nil {
+			return true
+		}
+		for _, san := range pc.SANs {
+			if cm.san.MatchString(san) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//peerCert returns the certificate the client of req presented or nil
+func peerCert(req *http.Request) *PeerCert {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	c := req.TLS.PeerCertificates[0]
+
+	sans := append([]string{}, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, c.EmailAddresses...)
+	for _, u := range c.URIs {
+		sans = append(sans, u.String())
+	}
+
+	return &PeerCert{
+		Subject:      c.Subject.String(),
+		CommonName:   c.Subject.CommonName,
+		Issuer:       c.Issuer.String(),
+		SerialNumber: c.SerialNumber.String(),
+		SANs:         sans,
+		NotBefore:    c.NotBefore,
+		NotAfter:     c.NotAfter,
+	}
+}
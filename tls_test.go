@@ -0,0 +1,275 @@
+package mockaroo
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//testPKI is a CA with the certificates it issued for tests
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	pool   *x509.CertPool
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "tls_test")
+	if err != nil {
+		t.Fatalf("cannot create temp dir error:%v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	p := &testPKI{dir: dir, pool: x509.NewCertPool()}
+	p.ca, p.caKey = p.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, "ca")
+	p.pool.AddCert(p.ca)
+	return p
+}
+
+//issue signs tmpl with the CA, self signed if there is no CA yet, and
+//writes <name>.crt and <name>.key to the PKI dir
+func (p *testPKI) issue(t *testing.T, tmpl *x509.Certificate, name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key error:%v", err)
+	}
+
+	p.serial++
+	tmpl.SerialNumber = big.NewInt(p.serial)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	parent, parentKey := tmpl, key
+	if p.ca != nil {
+		parent, parentKey = p.ca, p.caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("cannot create certificate error:%v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	ioutil.WriteFile(p.path(name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(p.path(name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return cert, key
+}
+
+func (p *testPKI) path(name string) string {
+	return filepath.Join(p.dir, name)
+}
+
+//client returns a HTTPS client trusting the CA presenting the named
+//client certificate if name is not empty
+func (p *testPKI) client(t *testing.T, name string) *http.Client {
+	config := &tls.Config{RootCAs: p.pool}
+	if name != "" {
+		cert, err := tls.LoadX509KeyPair(p.path(name+".crt"), p.path(name+".key"))
+		if err != nil {
+			t.Fatalf("cannot load client certificate error:%v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+}
+
+const mtlsTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	listener "secure" {
+		listen_addr    = "localhost:5443"
+		snake_oil_cert = "%[1]s/server.crt"
+		snake_oil_key  = "%[1]s/server.key"
+		tls {
+			client_ca   = "%[1]s/ca.crt"
+			client_auth = "%[2]s"
+			min_version = "1.2"
+		}
+	}
+
+	mock "alice" {
+		request {
+			path = "/whoami"
+			verb = "GET"
+			client_cert {
+				subject = "CN=alice"
+			}
+		}
+		response {
+			body = "hello {{.ClientCert.CommonName}} from {{.ClientCert.Issuer}}"
+		}
+	}
+
+	mock "service" {
+		request {
+			path = "/whoami"
+			verb = "GET"
+			client_cert {
+				san = "^spiffe://acme/"
+			}
+		}
+		response {
+			body = "hello service {{index .ClientCert.SANs 0}}"
+		}
+	}
+
+	mock "anyone" {
+		request {
+			path = "/whoami"
+			verb = "GET"
+		}
+		response {
+			body = "hello {{if .ClientCert}}stranger{{else}}anonymous{{end}}"
+		}
+	}
+}
+`
+
+//issueTestCerts issues a server certificate for localhost and client
+//certificates for alice and a billing service with a SPIFFE URI SAN
+func issueTestCerts(t *testing.T) *testPKI {
+	p := newTestPKI(t)
+	p.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, "server")
+	p.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "alice", Organization: []string{"Acme"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, "alice")
+	spiffe, _ := url.Parse("spiffe://acme/billing")
+	p.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		URIs:        []*url.URL{spiffe},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, "billing")
+	return p
+}
+
+func TestMutualTLS(t *testing.T) {
+	p := issueTestCerts(t)
+
+	for _, auth := range []string{ClientAuthRequire, ClientAuthRequest} {
+		t.Run(auth, func(t *testing.T) {
+			conf, err := LoadConfigFromBytes([]byte(fmt.Sprintf(mtlsTestConfig, p.dir, auth)))
+			if err != nil {
+				t.Fatalf("config load failed with error:%v", err)
+			}
+			ts := NewTestServer(t, conf)
+
+			tests := []struct {
+				client   string
+				expected string
+			}{
+				{"alice", "hello alice from CN=test ca"},
+				{"billing", "hello service spiffe://acme/billing"},
+				{"", "hello anonymous"},
+			}
+			for _, test := range tests {
+				resp, err := p.client(t, test.client).Get(ts.URLs["secure"] + "/whoami")
+				if test.client == "" && auth == ClientAuthRequire {
+					if err == nil {
+						resp.Body.Close()
+						t.Errorf("expected request without client certificate to fail")
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("request with client:%q failed with error:%v", test.client, err)
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if strings.TrimSpace(string(body)) != test.expected {
+					t.Errorf("client:%q expected body:%q found:%q", test.client, test.expected, body)
+				}
+			}
+
+			reqs := ts.Requests(RequestFilter{MockName: "alice"})
+			if len(reqs) != 1 || reqs[0].ClientCert == nil || reqs[0].ClientCert.Subject != "CN=alice,O=Acme" {
+				t.Errorf("expected the journal to record the client certificate of alice found:%+v", reqs)
+			}
+
+			// the plain listener has no client certificates
+			resp, err := http.Get(ts.URLs[defaultListenerName] + "/whoami")
+			if err != nil {
+				t.Fatalf("request to default listener failed with error:%v", err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if strings.TrimSpace(string(body)) != "hello anonymous" {
+				t.Errorf("expected body:hello anonymous found:%q", body)
+			}
+		})
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	p := issueTestCerts(t)
+	src := strings.Replace(fmt.Sprintf(mtlsTestConfig, p.dir, ClientAuthNone), `min_version = "1.2"`, `min_version = "1.3"`, 1)
+	conf, err := LoadConfigFromBytes([]byte(src))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	client := p.client(t, "")
+	client.Transport.(*http.Transport).TLSClientConfig.MaxVersion = tls.VersionTLS12
+	if resp, err := client.Get(ts.URLs["secure"] + "/whoami"); err == nil {
+		resp.Body.Close()
+		t.Errorf("expected TLS 1.2 client to be refused by a TLS 1.3 only listener")
+	}
+}
+
+func TestInvalidTLSConfigs(t *testing.T) {
+	p := issueTestCerts(t)
+	mock := "mock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n%s\n}\nresponse {\nbody = \"a\"\n}\n}\n"
+	https := fmt.Sprintf("listen_addr = \"localhost:5443\"\nsnake_oil_cert = \"%[1]s/server.crt\"\nsnake_oil_key = \"%[1]s/server.key\"\n", p.dir)
+
+	invalid := map[string][2]string{
+		"tls without cert":   {"listen_addr = \"localhost:5000\"\ntls {\nmin_version = \"1.2\"\n}", ""},
+		"bad client auth":    {https + "tls {\nclient_auth = \"always\"\n}", ""},
+		"missing client ca":  {https + "tls {\nclient_ca = \"" + p.path("nope.crt") + "\"\n}", ""},
+		"client ca not pem":  {https + "tls {\nclient_ca = \"" + p.path("ca.key") + "\"\n}", ""},
+		"bad min version":    {https + "tls {\nmin_version = \"1.4\"\n}", ""},
+		"unknown cipher":     {https + "tls {\ncipher_suites = [\"TLS_NOPE\"]\n}", ""},
+		"empty cert matcher": {"listen_addr = \"localhost:5000\"", "client_cert {}"},
+		"bad subject regexp": {"listen_addr = \"localhost:5000\"", "client_cert {\nsubject = \"(\"\n}"},
+	}
+
+	for name, test := range invalid {
+		src := "server {\n" + test[0] + "\n" + fmt.Sprintf(mock, test[1]) + "}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil {
+			t.Errorf("%v: expected config load to fail", name)
+		}
+	}
+
+	src := "server {\n" + https + "tls {\ncipher_suites = [\"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256\"]\n}\n" + fmt.Sprintf(mock, "") + "}\n"
+	if _, err := LoadConfigFromBytes([]byte(src)); err != nil {
+		t.Errorf("expected config with cipher suites to load found:%v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package mockaroo
+
+import (
+	"context"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//ConfigLoader loads and validates a config, typically a closure over LoadConfig
+//or LoadConfigGlob with the same arguments mockaroo was started with
+type ConfigLoader func() (*Config, error)
+
+// what is known about a watched file, a missing file is a valid state
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+//WatchConfig polls all the files conf was loaded from and every response file
+//referenced by its mocks, when any of them changes the config is reloaded with
+//load and swapped into server, if the changed config fails validation the error
+//is logged and the server keeps serving the old mocks; WatchConfig blocks until
+//ctx is done
+func WatchConfig(ctx context.Context, server MockServer, conf *Config, load ConfigLoader, interval time.Duration) {
+	// compare against the files as they were when conf was loaded so that
+	// changes made before the watch started are not missed
+	files := conf.watchFiles()
+	stamps := conf.loadStamps
+	if stamps == nil {
+		stamps = stampFiles(files)
+	}
+	log.Infof("watching %v files for changes every %v", len(files), interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !stampsChanged(stamps, stampFiles(files)) {
+			continue
+		}
+
+		log.Info("config change detected reloading...")
+		newConf, err := load()
+		if err != nil {
+			log.Errorf("config reload failed keeping the current mocks: %v", err)
+			// wait for the next change before trying again
+			stamps = stampFiles(files)
+			continue
+		}
+
+		if err := server.Reload(newConf); err != nil {
+			log.Errorf("config reload failed keeping the current mocks: %v", err)
+			stamps = stampFiles(files)
+			continue
+		}
+
+		// the new config might reference a different set of files
+		files = newConf.watchFiles()
+		stamps = newConf.loadStamps
+		if stamps == nil {
+			stamps = stampFiles(files)
+		}
+	}
+}
+
+func stampFiles(files []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(files))
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			stamps[f] = fileStamp{}
+			continue
+		}
+		stamps[f] = fileStamp{exists: true, modTime: fi.ModTime(), size: fi.Size()}
+	}
+	return stamps
+}
+
+func stampsChanged(old, new map[string]fileStamp) bool {
+	if len(old) != len(new) {
+		return true
+	}
+	for f, s := range new {
+		if o, present := old[f]; !present || o != s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package mockaroo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchConfigReloadsOnlyValidConfigs(t *testing.T) {
+	confTemplate := `
+	server {
+		listen_addr = "localhost:5000"
+		mock "hello_world" {
+			request {
+				path = "/hello"
+				verb = "GET"
+			}
+			response {
+				body = "%s"
+			}
+		}
+	}
+	`
+	f, err := ioutil.TempFile("", "watch_test*.hcl")
+	if err != nil {
+		t.Fatalf("failed to open temp file for testing")
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	configPath := f.Name()
+	writeConfig := func(content string) {
+		if err := ioutil.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write config for testing")
+		}
+	}
+	writeConfig(fmt.Sprintf(confTemplate, "first"))
+
+	conf, err := LoadConfig(&configPath)
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchConfig(ctx, ts, conf, func() (*Config, error) {
+		return LoadConfig(&configPath)
+	}, 10*time.Millisecond)
+
+	writeConfig(fmt.Sprintf(confTemplate, "second reload"))
+	if body := waitForBody(t, ts.URL+"/hello", "second reload"); body != "second reload" {
+		t.Fatalf("expected reloaded response body:second reload but found:%v", body)
+	}
+
+	// a broken config is logged and the old mocks keep on serving
+	writeConfig(`server { listen_addr = "localhost:5000" }`)
+	time.Sleep(100 * time.Millisecond)
+	if body := getBody(t, ts.URL+"/hello"); body != "second reload" {
+		t.Errorf("expected old response body:second reload after bad config but found:%v", body)
+	}
+
+	// fixing the config picks up the change again
+	writeConfig(fmt.Sprintf(confTemplate, "third"))
+	if body := waitForBody(t, ts.URL+"/hello", "third"); body != "third" {
+		t.Errorf("expected reloaded response body:third but found:%v", body)
+	}
+}
+
+func waitForBody(t *testing.T, url, expected string) string {
+	body := ""
+	for i := 0; i < 200; i++ {
+		if body = getBody(t, url); body == expected {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return body
+}
+
+func getBody(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("request to %v failed with error:%v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return strings.TrimSpace(string(body))
+}
+
+//reloadCounter counts the reloads of the server it wraps
+type reloadCounter struct {
+	MockServer
+	mu      sync.Mutex
+	reloads int
+}
+
+func (rc *reloadCounter) Reload(conf *Config) error {
+	rc.mu.Lock()
+	rc.reloads++
+	rc.mu.Unlock()
+	return rc.MockServer.Reload(conf)
+}
+
+func (rc *reloadCounter) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.reloads
+}
+
+func TestWatchConfigGlobDoesNotReloadUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch_glob_test")
+	if err != nil {
+		t.Fatalf("cannot create temp dir error:%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := "server {\nlisten_addr = \"localhost:5000\"\nmock \"m\" {\nrequest {\npath = \"/a\"\nverb = \"GET\"\n}\nresponse {\nbody = \"a\"\n}\n}\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.hcl"), []byte(src), 0644); err != nil {
+		t.Fatalf("cannot write config error:%v", err)
+	}
+
+	conf, err := LoadConfigGlob(dir)
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	rc := &reloadCounter{MockServer: NewTestServer(t, conf)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchConfig(ctx, rc, conf, func() (*Config, error) {
+		return LoadConfigGlob(dir)
+	}, 10*time.Millisecond)
+
+	time.Sleep(200 * time.Millisecond)
+	if n := rc.count(); n != 0 {
+		t.Errorf("expected no reloads of an unchanged glob config found:%v", n)
+	}
+}
@@ -0,0 +1,378 @@
+package mockaroo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// how long writing a message or a close frame can take
+	wsWriteTimeout = 5 * time.Second
+)
+
+//WebSocketScript upgrades the request to a WebSocket and runs a script on
+//it, messages are text and every message sent is a template
+type WebSocketScript struct {
+	Subprotocols []string      `hcl:"subprotocols,optional" json:"subprotocols,omitempty"` // offered to clients in the handshake
+	OnConnect    []string      `hcl:"on_connect,optional" json:"on_connect,omitempty"`     // sent as soon as the client connects
+	Replies      []*WSReply    `hcl:"reply,block" json:"replies,omitempty"`                // first reply matching a message is sent
+	Periodic     []*WSPeriodic `hcl:"periodic,block" json:"periodic,omitempty"`
+	Close        *WSClose      `hcl:"close,block" json:"close,omitempty"`
+
+	onConnect []*template.Template
+}
+
+//WSReply sends messages back when a client message matches
+type WSReply struct {
+	Match *BodyMatcher `hcl:"match,block" json:"match,omitempty"` // every message matches if not set
+	Send  []string     `hcl:"send" json:"send"`
+
+	send []*template.Template
+}
+
+//WSPeriodic sends a message every EveryMillis, Times times or until the
+//connection closes if Times is 0
+type WSPeriodic struct {
+	EveryMillis int    `hcl:"every_millis" json:"every_millis"`
+	Send        string `hcl:"send" json:"send"`
+	Times       int    `hcl:"times,optional" json:"times,omitempty"`
+
+	send *template.Template
+}
+
+//WSClose closes the connection with a close frame after AfterMessages client
+//messages or AfterMillis since the client connected, whichever comes first,
+//right after the on_connect messages if neither is set
+type WSClose struct {
+	AfterMillis   int    `hcl:"after_millis,optional" json:"after_millis,omitempty"`
+	AfterMessages int    `hcl:"after_messages,optional" json:"after_messages,omitempty"`
+	Code          int    `hcl:"code,optional" json:"code,omitempty"` // 1000 if not set
+	Reason        string `hcl:"reason,optional" json:"reason,omitempty"`
+}
+
+//WebSocketContext is what WebSocket messages are executed with, it has all
+//of the template context of the upgrade request
+type WebSocketContext struct {
+	*TemplateContext
+
+	//Message is the client message being replied to
+	Message string
+
+	//MessageJSON will be non nil if the message can be parsed as a JSON object
+	MessageJSON map[string]interface{}
+
+	//Tick counts the messages of a periodic block starting at 1
+	Tick int
+}
+
+//validateWebSocket compiles the templates of the websocket script of mock
+//and checks its timings and close code
+func validateWebSocket(fp string, mock *Mock, ws *WebSocketScript) error {
+	parse := func(what, src string) (*template.Template, error) {
+		tmpl, err := template.New(mock.Name).Parse(src)
+		if err != nil {
+			errMsg := fmt.Sprintf("error parsing websocket %s template for mock \"%s\" error:%v", what, mock.Name, err)
+			return nil, invalidConfErr(fp, errMsg)
+		}
+		return tmpl, nil
+	}
+
+	ws.onConnect = nil
+	for _, msg := range ws.OnConnect {
+		tmpl, err := parse("on_connect", msg)
+		if err != nil {
+			return err
+		}
+		ws.onConnect = append(ws.onConnect, tmpl)
+	}
+
+	for _, r := range ws.Replies {
+		if r.Match != nil {
+			if err := validateBodyMatcher(fp, mock, r.Match); err != nil {
+				return err
+			}
+		}
+		if len(r.Send) == 0 {
+			errMsg := fmt.Sprintf("websocket reply has nothing to send for mock \"%s\"", mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		r.send = nil
+		for _, msg := range r.Send {
+			tmpl, err := parse("reply", msg)
+			if err != nil {
+				return err
+			}
+			r.send = append(r.send, tmpl)
+		}
+	}
+
+	for _, p := range ws.Periodic {
+		if p.EveryMillis <= 0 {
+			errMsg := fmt.Sprintf("websocket periodic every_millis should be > 0 found %v for mock \"%s\"", p.EveryMillis, mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		if p.Times < 0 {
+			errMsg := fmt.Sprintf("websocket periodic times should be >= 0 found %v for mock \"%s\"", p.Times, mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		tmpl, err := parse("periodic", p.Send)
+		if err != nil {
+			return err
+		}
+		p.send = tmpl
+	}
+
+	if c := ws.Close; c != nil {
+		if c.AfterMillis < 0 || c.AfterMessages < 0 {
+			errMsg := fmt.Sprintf("websocket close after_millis and after_messages should be >= 0 for mock \"%s\"", mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		if c.Code == 0 {
+			c.Code = websocket.CloseNormalClosure
+		}
+		// 1005, 1006 and 1015 are never sent in a close frame
+		if c.Code < 1000 || c.Code > 4999 || c.Code == websocket.CloseNoStatusReceived ||
+			c.Code == websocket.CloseAbnormalClosure || c.Code == websocket.CloseTLSHandshake || c.Code == 1004 {
+			errMsg := fmt.Sprintf("invalid websocket close code %v for mock \"%s\"", c.Code, mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+		// a close frame can carry 125 bytes, 2 of them are the code
+		if len(c.Reason) > 123 {
+			errMsg := fmt.Sprintf("websocket close reason longer than 123 bytes for mock \"%s\"", mock.Name)
+			return invalidConfErr(fp, errMsg)
+		}
+	}
+	return nil
+}
+
+//serveWebSocket upgrades req and runs the websocket script of response
+//until the script closes the connection, the client goes away or the
+//server shuts down
+func (s *muxServer) serveWebSocket(w http.ResponseWriter, req *http.Request, mock *Mock, response *Response) {
+	ws := response.WebSocket
+
+	// the template context is taken before the upgrade while the body
+	// can still be read
+	tc := NewTemplateContext(req)
+
+	header := make(http.Header)
+	for key, val := range response.Headers {
+		header.Add(key, val)
+	}
+	upgrader := websocket.Upgrader{
+		Subprotocols: ws.Subprotocols,
+		// mocks stand in for servers on other origins too
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(w, req, header)
+	if err != nil {
+		// the upgrader has already answered with an error status
+		log.Warnf("websocket upgrade failed for mock:\"%v\" error:%v", mock.Name, err)
+		return
+	}
+	defer conn.Close()
+
+	// the connection is hijacked, record the switch of protocols
+	if sw, ok := w.(*statusWriter); ok {
+		sw.status = http.StatusSwitchingProtocols
+	}
+	log.Infof("websocket connected for mock:\"%v\"", mock.Name)
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	s.trackWebSocket(conn, cancel)
+	defer s.untrackWebSocket(conn)
+
+	script := &wsScript{mock: mock, ws: ws, conn: conn, tc: tc}
+	script.run(ctx)
+}
+
+//wsScript is a running websocket script, all writes happen on the
+//goroutine running it as gorilla connections take one writer at a time
+type wsScript struct {
+	mock *Mock
+	ws   *WebSocketScript
+	conn *websocket.Conn
+	tc   *TemplateContext
+}
+
+func (sc *wsScript) run(ctx context.Context) {
+	for _, tmpl := range sc.ws.onConnect {
+		if !sc.send(tmpl, &WebSocketContext{TemplateContext: sc.tc}) {
+			return
+		}
+	}
+
+	c := sc.ws.Close
+	var closeTimer <-chan time.Time
+	if c != nil {
+		if c.AfterMillis == 0 && c.AfterMessages == 0 {
+			sc.close(c.Code, c.Reason)
+			return
+		}
+		if c.AfterMillis > 0 {
+			t := time.NewTimer(time.Duration(c.AfterMillis) * time.Millisecond)
+			defer t.Stop()
+			closeTimer = t.C
+		}
+	}
+
+	messages := make(chan []byte)
+	readErrs := make(chan error, 1)
+	go func() {
+		for {
+			_, msg, err := sc.conn.ReadMessage()
+			if err != nil {
+				readErrs <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticks := make(chan wsTick)
+	for _, p := range sc.ws.Periodic {
+		go tick(ctx, p, ticks)
+	}
+
+	received := 0
+	for {
+		select {
+		case msg := <-messages:
+			received++
+			if !sc.reply(msg) {
+				return
+			}
+			if c != nil && c.AfterMessages > 0 && received >= c.AfterMessages {
+				sc.close(c.Code, c.Reason)
+				return
+			}
+		case t := <-ticks:
+			if !sc.send(t.periodic.send, &WebSocketContext{TemplateContext: sc.tc, Tick: t.n}) {
+				return
+			}
+		case <-closeTimer:
+			sc.close(c.Code, c.Reason)
+			return
+		case err := <-readErrs:
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Warnf("websocket for mock:\"%v\" closed error:%v", sc.mock.Name, err)
+			} else {
+				log.Infof("websocket for mock:\"%v\" closed by the client", sc.mock.Name)
+			}
+			return
+		case <-ctx.Done():
+			sc.close(websocket.CloseGoingAway, "mockaroo shutting down")
+			return
+		}
+	}
+}
+
+//wsTick is the nth message of a periodic block being due
+type wsTick struct {
+	periodic *WSPeriodic
+	n        int
+}
+
+//tick hands the messages of p to the script as they fall due
+func tick(ctx context.Context, p *WSPeriodic, ticks chan<- wsTick) {
+	ticker := time.NewTicker(time.Duration(p.EveryMillis) * time.Millisecond)
+	defer ticker.Stop()
+	for n := 1; p.Times == 0 || n <= p.Times; n++ {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case ticks <- wsTick{periodic: p, n: n}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//reply sends the messages of the first reply matching msg, false if the
+//connection is broken
+func (sc *wsScript) reply(msg []byte) bool {
+	for _, r := range sc.ws.Replies {
+		if r.Match != nil && !r.Match.match(msg) {
+			continue
+		}
+		wc := &WebSocketContext{TemplateContext: sc.tc, Message: string(msg)}
+		json.Unmarshal(msg, &wc.MessageJSON)
+		for _, tmpl := range r.send {
+			if !sc.send(tmpl, wc) {
+				return false
+			}
+		}
+		return true
+	}
+	log.Infof("websocket message for mock:\"%v\" did not match any reply", sc.mock.Name)
+	return true
+}
+
+//send executes tmpl and writes it out as a text message, false if the
+//connection is broken
+func (sc *wsScript) send(tmpl *template.Template, wc *WebSocketContext) bool {
+	var msg bytes.Buffer
+	if err := tmpl.Execute(&msg, wc); err != nil {
+		// a broken template does not break the connection
+		log.Errorf("template execution failed for websocket message of mock \"%v\" error:%v", sc.mock.Name, err)
+		return true
+	}
+	sc.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := sc.conn.WriteMessage(websocket.TextMessage, msg.Bytes()); err != nil {
+		log.Warnf("error writing websocket message for mock:\"%v\" error:%v", sc.mock.Name, err)
+		return false
+	}
+	return true
+}
+
+//close sends a close frame with code and reason, the connection itself is
+//closed once the script returns
+func (sc *wsScript) close(code int, reason string) {
+	log.Infof("closing websocket for mock:\"%v\" with code:%v", sc.mock.Name, code)
+	frame := websocket.FormatCloseMessage(code, reason)
+	if err := sc.conn.WriteControl(websocket.CloseMessage, frame, time.Now().Add(wsWriteTimeout)); err != nil {
+		log.Warnf("error closing websocket for mock:\"%v\" error:%v", sc.mock.Name, err)
+	}
+}
+
+//trackWebSocket keeps conn around until untracked so that shutting the
+//server down can end its script, hijacked connections are not drained
+func (s *muxServer) trackWebSocket(conn *websocket.Conn, cancel context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.webSockets == nil {
+		s.webSockets = make(map[*websocket.Conn]context.CancelFunc)
+	}
+	s.webSockets[conn] = cancel
+}
+
+func (s *muxServer) untrackWebSocket(conn *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.webSockets, conn)
+}
+
+//closeWebSockets ends the scripts of all open websockets
+func (s *muxServer) closeWebSockets() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cancel := range s.webSockets {
+		cancel()
+	}
+}
@@ -0,0 +1,223 @@
+package mockaroo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const websocketTestConfig = `
+server {
+	listen_addr = "localhost:5000"
+
+	mock "notifications" {
+		request {
+			path = "/ws"
+			verb = "GET"
+		}
+		response {
+			headers = {
+				x-mock = "notifications"
+			}
+			websocket {
+				subprotocols = ["notify.v1"]
+				on_connect   = ["{\"type\":\"hello\",\"user\":\"{{.Form.Get \"user\"}}\"}"]
+
+				reply {
+					match {
+						json_path = {
+							"type" = "^subscribe$"
+						}
+					}
+					send = ["{\"type\":\"subscribed\",\"topic\":\"{{.MessageJSON.topic}}\"}"]
+				}
+
+				reply {
+					match {
+						matches = "^ping"
+					}
+					send = ["pong", "{{.Message}}"]
+				}
+
+				periodic {
+					every_millis = 20
+					times        = 2
+					send         = "tick {{.Tick}}"
+				}
+
+				close {
+					after_messages = 3
+					code           = 4001
+					reason         = "done"
+				}
+			}
+		}
+	}
+
+	mock "goodbye" {
+		request {
+			path = "/bye"
+			verb = "GET"
+		}
+		response {
+			websocket {
+				on_connect = ["bye"]
+				close {
+					code = 1001
+				}
+			}
+		}
+	}
+}
+`
+
+func startWebSocketTestServer(t *testing.T) *TestServer {
+	conf, err := LoadConfigFromBytes([]byte(websocketTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	return NewTestServer(t, conf)
+}
+
+func dialWebSocket(t *testing.T, ts *TestServer, path string) (*websocket.Conn, *http.Response) {
+	dialer := &websocket.Dialer{Subprotocols: []string{"notify.v1"}, HandshakeTimeout: time.Second}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+path, nil)
+	if err != nil {
+		t.Fatalf("cannot dial %v error:%v", path, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn, resp
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("cannot read message error:%v", err)
+	}
+	return string(msg)
+}
+
+func TestWebSocketScript(t *testing.T) {
+	ts := startWebSocketTestServer(t)
+	conn, resp := dialWebSocket(t, ts, "/ws?user=alice")
+
+	if resp.Header.Get("X-Mock") != "notifications" || conn.Subprotocol() != "notify.v1" {
+		t.Errorf("expected header x-mock and subprotocol notify.v1 found:%v %q", resp.Header, conn.Subprotocol())
+	}
+	if msg := readMessage(t, conn); msg != `{"type":"hello","user":"alice"}` {
+		t.Errorf("expected hello found:%q", msg)
+	}
+
+	// periodic messages are sent while the client is quiet
+	for i := 1; i <= 2; i++ {
+		if msg := readMessage(t, conn); msg != fmt.Sprintf("tick %d", i) {
+			t.Errorf("expected tick %d found:%q", i, msg)
+		}
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribe","topic":"orders"}`))
+	if msg := readMessage(t, conn); msg != `{"type":"subscribed","topic":"orders"}` {
+		t.Errorf("expected subscribed to orders found:%q", msg)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte("ping 1"))
+	for _, expected := range []string{"pong", "ping 1"} {
+		if msg := readMessage(t, conn); msg != expected {
+			t.Errorf("expected %q found:%q", expected, msg)
+		}
+	}
+
+	// messages that match no reply are ignored but still count
+	conn.WriteMessage(websocket.TextMessage, []byte("nope"))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, 4001) || !strings.Contains(err.Error(), "done") {
+		t.Errorf("expected close 4001 done found:%v", err)
+	}
+
+	// the request is journaled once the connection is over
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && len(ts.Requests(RequestFilter{MockName: "notifications"})) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	reqs := ts.Requests(RequestFilter{MockName: "notifications"})
+	if len(reqs) != 1 || reqs[0].Status != http.StatusSwitchingProtocols {
+		t.Errorf("expected the journal to record the upgrade found:%+v", reqs)
+	}
+}
+
+func TestWebSocketCloseOnConnect(t *testing.T) {
+	ts := startWebSocketTestServer(t)
+	conn, _ := dialWebSocket(t, ts, "/bye")
+
+	if msg := readMessage(t, conn); msg != "bye" {
+		t.Errorf("expected bye found:%q", msg)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected close 1001 found:%v", err)
+	}
+
+	// plain requests cannot be upgraded
+	resp, err := http.Get(ts.URL + "/bye")
+	if err != nil {
+		t.Fatalf("request failed with error:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a plain request found:%v", resp.StatusCode)
+	}
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	conf, err := LoadConfigFromBytes([]byte(websocketTestConfig))
+	if err != nil {
+		t.Fatalf("config load failed with error:%v", err)
+	}
+	ts := NewTestServer(t, conf)
+	conn, _ := dialWebSocket(t, ts, "/ws")
+	readMessage(t, conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go ts.Shutdown(ctx)
+
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("expected close 1001 on shutdown found:%v", err)
+		}
+		break
+	}
+}
+
+func TestInvalidWebSocketConfigs(t *testing.T) {
+	mock := "mock \"m\" {\nrequest {\npath = \"/ws\"\nverb = \"GET\"\n}\nresponse {\n%s\n}\n}\n"
+
+	invalid := map[string]string{
+		"websocket and body":  "body = \"a\"\nwebsocket {}",
+		"bad template":        "websocket {\non_connect = [\"{{\"]\n}",
+		"reply without send":  "websocket {\nreply {\nsend = []\n}\n}",
+		"bad reply regexp":    "websocket {\nreply {\nmatch {\nmatches = \"(\"\n}\nsend = [\"a\"]\n}\n}",
+		"zero every_millis":   "websocket {\nperiodic {\nevery_millis = 0\nsend = \"a\"\n}\n}",
+		"negative times":      "websocket {\nperiodic {\nevery_millis = 10\ntimes = -1\nsend = \"a\"\n}\n}",
+		"reserved close code": "websocket {\nclose {\ncode = 1006\n}\n}",
+		"close code range":    "websocket {\nclose {\ncode = 5000\n}\n}",
+		"negative after":      "websocket {\nclose {\nafter_millis = -1\n}\n}",
+	}
+
+	for name, response := range invalid {
+		src := "server {\nlisten_addr = \"localhost:5000\"\n" + fmt.Sprintf(mock, response) + "}\n"
+		if _, err := LoadConfigFromBytes([]byte(src)); err == nil {
+			t.Errorf("%v: expected config load to fail", name)
+		}
+	}
+}